@@ -0,0 +1,176 @@
+package chunker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultChunkBytes is the size a chunk grows to before the Chunker cuts it,
+// unless Chunker.Bytes says otherwise.
+const DefaultChunkBytes = 1 << 20
+
+// Chunker splits a (potentially huge) top-level JSON array of objects into
+// smaller JSON arrays of whole objects, so each one can be handed to its own
+// Parser. A chunk is cut as soon as it holds Objects objects or has grown past
+// Bytes bytes, whichever happens first. A zero value disables that limit, and
+// every chunk holds at least one object, however big it is.
+//
+// If the input is a single top-level object rather than an array, it's
+// returned as-is as the only chunk.
+type Chunker struct {
+	Objects int
+	Bytes   int
+
+	r      *bufio.Reader
+	begun  bool
+	single bool
+	done   bool
+}
+
+func NewChunker(r io.Reader) *Chunker {
+	return &Chunker{
+		Bytes: DefaultChunkBytes,
+		r:     bufio.NewReader(r),
+	}
+}
+
+// Chunk returns the next chunk of objects, wrapped in '[' and ']'. It returns
+// io.EOF once the whole array has been consumed.
+func (c *Chunker) Chunk() ([]byte, error) {
+	if !c.begun {
+		if err := c.begin(); err != nil {
+			return nil, err
+		}
+	}
+	if c.done {
+		return nil, io.EOF
+	}
+	buf := &bytes.Buffer{}
+	if c.single {
+		c.done = true
+		if err := c.object(buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	buf.WriteByte('[')
+	for objects := 0; !c.done; objects++ {
+		// a chunk always gets at least one object, even one bigger than Bytes
+		if (c.Objects > 0 && objects >= c.Objects) || (c.Bytes > 0 && objects > 0 && buf.Len() >= c.Bytes) {
+			break
+		}
+		if objects > 0 {
+			buf.WriteByte(',')
+		}
+		if err := c.object(buf); err != nil {
+			return nil, err
+		}
+		// each object is followed by either another one or the end of the
+		// array
+		b, err := c.next()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		switch b {
+		case ',':
+		case ']':
+			c.done = true
+		default:
+			return nil, fmt.Errorf("expected ',' or ']' after object, instead found: %c", b)
+		}
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// begin consumes the opening '[' of the array, or leaves the opening '{' of a
+// single object in place.
+func (c *Chunker) begin() error {
+	c.begun = true
+	b, err := c.next()
+	if err == io.EOF {
+		c.done = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch b {
+	case '[':
+		// check for an empty array so Chunk doesn't go looking for an object
+		if b, err = c.next(); err != nil {
+			return unexpected(err)
+		}
+		if b == ']' {
+			c.done = true
+			return nil
+		}
+		return c.r.UnreadByte()
+	case '{':
+		c.single = true
+		return c.r.UnreadByte()
+	}
+	return fmt.Errorf("expected '[' or '{' at start of input, instead found: %c", b)
+}
+
+// next returns the next byte that isn't whitespace.
+func (c *Chunker) next() (byte, error) {
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, nil
+	}
+}
+
+// object copies the next object from the reader into buf. Braces inside of
+// strings are ignored, so we have to keep track of whether we're in a string
+// and whether the current byte is escaped.
+func (c *Chunker) object(buf *bytes.Buffer) error {
+	b, err := c.next()
+	if err != nil {
+		return unexpected(err)
+	}
+	if b != '{' {
+		return fmt.Errorf("expected object, instead found: %c", b)
+	}
+	buf.WriteByte(b)
+	depth, str, escaped := 1, false, false
+	for depth > 0 {
+		if b, err = c.r.ReadByte(); err != nil {
+			return unexpected(err)
+		}
+		buf.WriteByte(b)
+		switch {
+		case escaped:
+			escaped = false
+		case str && b == '\\':
+			escaped = true
+		case b == '"':
+			str = !str
+		case str:
+		case b == '{':
+			depth++
+		case b == '}':
+			depth--
+		}
+	}
+	return nil
+}
+
+// unexpected turns io.EOF into io.ErrUnexpectedEOF, as running out of input in
+// the middle of an array is never the normal end of a stream.
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package chunker
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+func TestChunker(t *testing.T) {
+	c := NewChunker(strings.NewReader(`[
+		{"name": "Alice", "friend": {"name": "Bob"}},
+		{"name": "Charlie {with} \"braces\""},
+		{"name": "David"}
+	]`))
+	c.Objects = 2
+	expected := []string{
+		`[{"name": "Alice", "friend": {"name": "Bob"}},{"name": "Charlie {with} \"braces\""}]`,
+		`[{"name": "David"}]`,
+	}
+	for i, e := range expected {
+		chunk, err := c.Chunk()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(chunk) != e {
+			t.Fatalf("expected chunk %d to be %s but got %s\n", i, e, chunk)
+		}
+	}
+	if _, err := c.Chunk(); err != io.EOF {
+		t.Fatalf("expected io.EOF but got %v\n", err)
+	}
+}
+
+func TestChunkerBytes(t *testing.T) {
+	// 1 is reached by the opening '[' of a chunk on its own
+	for _, size := range []int{1, 8} {
+		c := NewChunker(strings.NewReader(`[{"a": 1}, {"b": 2}, {"c": 3}]`))
+		c.Bytes = size
+		chunks := 0
+		for {
+			chunk, err := c.Chunk()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chunks == 3 {
+				t.Fatalf("expected 3 chunks but got more (bytes: %d)\n", size)
+			}
+			p := NewParser()
+			if err = p.Run(chunk); err != nil {
+				t.Fatal(err)
+			}
+			if len(p.Quads) != 1 {
+				t.Fatalf("expected 1 quad for chunk %d but got %d (bytes: %d)\n", chunks, len(p.Quads), size)
+			}
+			chunks++
+		}
+		if chunks != 3 {
+			t.Fatalf("expected 3 chunks but got %d (bytes: %d)\n", chunks, size)
+		}
+	}
+}
+
+func TestChunkerSingle(t *testing.T) {
+	c := NewChunker(strings.NewReader(` {"name": "Alice"} `))
+	chunk, err := c.Chunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewParser()
+	if err = p.Run(chunk); err != nil {
+		t.Fatal(err)
+	}
+	checkQuads(t, p.Quads, []*api.NQuad{
+		{Subject: "_:c.1", Predicate: "name", ObjectValue: val("Alice")},
+	})
+	if _, err = c.Chunk(); err != io.EOF {
+		t.Fatalf("expected io.EOF but got %v\n", err)
+	}
+}
+
+func TestChunkerErrors(t *testing.T) {
+	for _, d := range []string{
+		`"name"`,
+		`[{"name": "Alice"`,
+		`[{"name": "Alice"} {"name": "Bob"}]`,
+		`[1, 2]`,
+	} {
+		c := NewChunker(strings.NewReader(d))
+		if _, err := c.Chunk(); err == nil || err == io.EOF {
+			t.Fatalf("expected an error for %s but got %v\n", d, err)
+		}
+	}
+}
@@ -1,30 +1,27 @@
 package chunker
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dgraph-io/dgo/v2/protos/api"
 	"github.com/dgraph-io/dgraph/types"
 	"github.com/dgraph-io/dgraph/types/facets"
 	"github.com/minio/simdjson-go"
-	"github.com/twpayne/go-geom"
-	"github.com/twpayne/go-geom/encoding/geojson"
 )
 
-type Quad struct {
-	Subject   string
-	Predicate string
-	ObjectId  string
-	ObjectVal interface{}
-	Facets    []*api.Facet
-}
+// Star is Dgraph's wildcard, a Predicate or DefaultVal of Star is written as *
+// in delete mutations.
+const Star = "_STAR_ALL"
 
-func NewQuad() *Quad {
-	return &Quad{Facets: make([]*api.Facet, 0)}
+// NewQuad returns an empty NQuad ready to be filled in by the Parser.
+func NewQuad() *api.NQuad {
+	return &api.NQuad{Facets: make([]*api.Facet, 0)}
 }
 
 type ParserState func(byte) (ParserState, error)
@@ -32,43 +29,181 @@ type ParserState func(byte) (ParserState, error)
 type Parser struct {
 	Cursor       uint64
 	StringCursor uint64
-	Quad         *Quad
+	Quad         *api.NQuad
 	Facet        *api.Facet
-	Quads        []*Quad
+	Quads        []*api.NQuad
 	Levels       *ParserLevels
 	Parsed       *simdjson.ParsedJson
 	FacetPred    string
+	FacetLang    string
 	FacetId      int
-	Iter         simdjson.Iter
+	// Fallback forces the Parser to use encoding/json rather than simdjson,
+	// which it does anyway on CPUs simdjson doesn't support
+	Fallback bool
+	// Lenient makes the Parser drop a top-level object that can't be parsed
+	// (along with its quads) and move on to the next one, rather than giving
+	// up on the whole document. The errors end up in Errors.
+	Lenient bool
+	Errors  []*ParseError
+	// Warnings holds facets that were dropped because there was no quad for
+	// them in their object
+	Warnings []*ParseError
+	// Handler, if set, gets every quad instead of Quads, see QuadHandler
+	Handler QuadHandler
+	// Delete makes the Parser produce a delete set, following Dgraph's JSON
+	// delete semantics:
+	//
+	//   - "pred": null deletes every value of pred (S P *)
+	//   - {"uid": "0x1"} with no other keys deletes the whole node (S * *)
+	//   - anything else deletes exactly that value or edge
+	//
+	// Every object needs a uid, there's no point deleting generated subjects.
+	Delete bool
+	// Schema, if set, types the values of its predicates the way Dgraph would
+	// (strings to datetimes, ints to floats, and so on) rather than by their
+	// JSON token. A value that can't be converted is an ErrSchema error.
+	Schema *Schema
+	// Types, if set, picks the dgraph.type of every object with a generated
+	// subject, see TypeRule
+	Types TypeRule
+	// Xids maps a type to the predicate holding its external id, like
+	// {"Customer": "customer_id"}. An object with a generated subject and an
+	// xid gets the xid's subject from XidMap instead (a MemoryXidMap if it's
+	// nil), so it's the same node everywhere it shows up. The type is the
+	// object's dgraph.type, the "" type is for objects without one in Xids.
+	Xids   map[string]string
+	XidMap XidMap
+	// Keys makes the Parser produce an upsert, see Upsert. An object with a
+	// generated subject and a value for one of the Keys gets a query variable
+	// (in Vars) as its subject, like uid(v1).
+	Keys []string
+	Vars []*UpsertVar
+
+	slab   quadSlab
+	facets facetSlab
+	states parserStates
+	// vars holds the Vars by predicate and value
+	vars map[[2]string]*UpsertVar
+	// document is the index of the current document in the stream, for
+	// errors
+	document int
+}
+
+// parserStates holds the Parser's ParserStates. Every time a method value like
+// p.Object is returned it has to be allocated, so they're bound once.
+type parserStates struct {
+	root        ParserState
+	object      ParserState
+	mapFacet    ParserState
+	mapFacetVal ParserState
+	scalarFacet ParserState
+	array       ParserState
+	value       ParserState
+	uid         ParserState
+}
+
+func (p *Parser) bindStates() {
+	p.states = parserStates{
+		root:        p.Root,
+		object:      p.Object,
+		mapFacet:    p.MapFacet,
+		mapFacetVal: p.MapFacetVal,
+		scalarFacet: p.ScalarFacet,
+		array:       p.Array,
+		value:       p.Value,
+		uid:         p.Uid,
+	}
 }
 
 func NewParser() *Parser {
 	return &Parser{
-		Cursor: 1,
-		Quad:   NewQuad(),
-		Quads:  make([]*Quad, 0),
-		Levels: NewParserLevels(),
-		Facet:  &api.Facet{},
+		Cursor:   1,
+		Quad:     NewQuad(),
+		Quads:    make([]*api.NQuad, 0),
+		Levels:   NewParserLevels(),
+		Facet:    &api.Facet{},
+		Errors:   make([]*ParseError, 0),
+		Warnings: make([]*ParseError, 0),
 	}
 }
 
 func (p *Parser) Run(d []byte) (err error) {
-	if p.Parsed, err = simdjson.Parse(d, nil); err != nil {
-		return
+	if p.useFallback() {
+		p.Parsed, err = parseFallback(d, p.Parsed)
+	} else {
+		p.Parsed, err = simdjson.Parse(d, p.Parsed)
+	}
+	if err != nil {
+		return jsonError(err)
 	}
-	p.Iter = p.Parsed.Iter()
-	for state := p.Root; state != nil; p.Cursor++ {
+	p.document = 0
+	return p.walk(nil)
+}
+
+// walk runs the ParserState machine over p.Parsed. A tape from ParseND holds
+// one root node pair per document, so every closing root node calls done (if
+// it isn't nil) and sends the machine back to Root for the next document.
+//
+// Quads are handed to the Handler (if there is one) after each top-level
+// object, and before done is called.
+//
+// Errors from done are returned as they are, ParseErrors from the states get
+// the position of the node that caused them (and are skipped in Lenient
+// mode).
+func (p *Parser) walk(done func() error) (err error) {
+	p.Cursor = 1
+	p.StringCursor = 0
+	if p.states.root == nil {
+		p.bindStates()
+	}
+	// mark is how many quads (and upsert vars) there were before the current
+	// top-level object
+	mark, vars := len(p.Quads), len(p.Vars)
+	for state := p.states.root; state != nil; p.Cursor++ {
 		if p.Cursor >= uint64(len(p.Parsed.Tape)) {
-			return
+			break
 		}
-		p.Iter.AdvanceInto()
-		//t := p.Iter.AdvanceInto()
-		//fmt.Printf("%v %d %c\n", t, p.Cursor, p.Parsed.Tape[p.Cursor]>>56)
-		if state, err = state(byte(p.Parsed.Tape[p.Cursor] >> 56)); err != nil {
-			return
+		//fmt.Printf("%d %c\n", p.Cursor, p.Parsed.Tape[p.Cursor]>>56)
+		n := byte(p.Parsed.Tape[p.Cursor] >> 56)
+		if n == 'r' {
+			// an opening root node points forward to its closing root node,
+			// there's nothing to do until we reach the closing one
+			if p.Parsed.Tape[p.Cursor]&simdjson.JSONVALUEMASK > p.Cursor {
+				continue
+			}
+			if err = p.flush(); err != nil {
+				return
+			}
+			if done != nil {
+				if err = done(); err != nil {
+					return
+				}
+			}
+			p.document++
+			state = p.states.root
+			continue
+		}
+		if len(p.Levels.Levels) == 0 || len(p.Levels.Levels) == 1 && p.Levels.Levels[0].Array {
+			// between top-level objects, so every quad so far is complete
+			if err = p.flush(); err != nil {
+				return
+			}
+			mark, vars = len(p.Quads), len(p.Vars)
+		}
+		node := p.Cursor
+		if state, err = state(n); err != nil {
+			e, ok := err.(*ParseError)
+			if !ok {
+				return
+			}
+			p.locate(e, node)
+			if !p.Lenient {
+				return
+			}
+			state, err = p.skipRecord(e, mark, vars), nil
 		}
 	}
-	return
+	return p.flush()
 }
 
 // String is called when we encounter a '"' (string) node and want to get the
@@ -89,31 +224,56 @@ func (p *Parser) String() string {
 func (p *Parser) Root(n byte) (ParserState, error) {
 	switch n {
 	case '{':
-		p.Levels.Deeper(false)
-		return p.Object, nil
+		p.deeper(false)
+		return p.states.object, nil
 	case '[':
-		p.Levels.Deeper(true)
-		return p.Array, nil
+		p.deeper(true)
+		return p.states.array, nil
 	}
-	return nil, nil
+	return nil, valueError(n)
 }
 
 // Object is the most common state for the Parser to be in--we're usually in an
 // object of some kind.
 func (p *Parser) Object(n byte) (ParserState, error) {
+	// Object is returned to after an object in an array, so anything else in
+	// the array ends up here too
+	if l := p.Levels.Get(0); l != nil && l.Array {
+		return p.Array(n)
+	}
 	switch n {
 	case '{':
-		p.Levels.Deeper(false)
-		return p.Object, nil
+		p.deeper(false)
+		return p.states.object, nil
 	case '}':
 		l := p.Levels.Get(0)
+		if len(l.pending) > 0 {
+			p.resolvePending(l)
+		}
+		if p.Delete {
+			if err := p.deleteObject(l); err != nil {
+				return nil, err
+			}
+		} else if !l.Uid {
+			if p.Types != nil {
+				p.typeObject(l)
+			}
+			if p.Xids != nil {
+				if err := p.xidObject(l); err != nil {
+					return nil, err
+				}
+			}
+			if p.Keys != nil {
+				p.keyObject(l)
+			}
+		}
 		// check if the current level has anything waiting to be pushed, if the
 		// current level is scalars we don't push anything
 		if l.Wait != nil && !l.Scalars {
 			p.Quad = l.Wait
 			p.Quad.ObjectId = l.Subject
-			p.Quads = append(p.Quads, p.Quad)
-			p.Quad = NewQuad()
+			p.appendEdge(p.Quad, p.Levels.Object(1))
+			p.Quad = p.newQuad()
 		} else {
 			if p.Levels.InArray() {
 				a := p.Levels.Get(1)
@@ -121,111 +281,136 @@ func (p *Parser) Object(n byte) (ParserState, error) {
 					p.Quad.Subject = a.Wait.Subject
 					p.Quad.Predicate = a.Wait.Predicate
 					p.Quad.ObjectId = l.Subject
-					p.Quad.Facets = a.Wait.Facets
-					p.Quads = append(p.Quads, p.Quad)
-					p.Quad = NewQuad()
+					// every edge gets its own copy of the array's facets, map
+					// facets are added to each one separately
+					p.Quad.Facets = append(p.Quad.Facets, a.Wait.Facets...)
+					p.appendEdge(p.Quad, p.Levels.Object(1))
+					p.Quad = p.newQuad()
 				}
 			}
 		}
 		p.Levels.Pop()
-		return p.Object, nil
+		return p.states.object, nil
 	case ']':
 		p.Levels.Pop()
-		return p.Object, nil
+		return p.states.object, nil
 	case '"':
 		s := p.String()
+		p.Levels.Get(0).Keys++
 		if s == "uid" {
-			return p.Uid, nil
+			return p.states.uid, nil
 		}
 		// check if this is a facet definition
-		if strings.Contains(s, "|") {
-			e := strings.Split(s, "|")
-			if len(e) == 2 {
-				p.FacetPred = e[0]
-				p.Facet.Key = e[1]
-				// peek at the next node to see if it's a scalar facet or map
-				next := byte(p.Parsed.Tape[p.Cursor+1] >> 56)
-				if next == '{' {
-					// go into the object so MapFacet can immediately check the
-					// keys
-					p.Cursor++
-					p.Iter.AdvanceInto()
-					return p.MapFacet, nil
-				}
-				return p.ScalarFacet, nil
-			}
-		} else {
+		if !strings.Contains(s, "|") {
 			// found a normal nquad
+			pred, lang, err := splitLang(s)
+			if err != nil {
+				return nil, newParseError(ErrLang, s, err)
+			}
 			p.Quad.Subject = p.Levels.Subject()
-			p.Quad.Predicate = s
-			return p.Value, nil
+			p.Quad.Predicate = pred
+			p.Quad.Lang = lang
+			return p.states.value, nil
+		}
+		e := strings.Split(s, "|")
+		if len(e) != 2 || e[0] == "" || e[1] == "" {
+			return nil, newParseError(ErrKey, s,
+				errors.New(fmt.Sprintf("expected a key like predicate|facet, instead found: %s", s)))
+		}
+		pred, lang, err := splitLang(e[0])
+		if err != nil {
+			return nil, newParseError(ErrLang, e[0], err)
 		}
-		// not sure what this string is, try again
-		return p.Object, nil
+		p.FacetPred = pred
+		p.FacetLang = lang
+		p.Facet.Key = e[1]
+		// peek at the next node to see if it's a scalar facet or map
+		next := byte(p.Parsed.Tape[p.Cursor+1] >> 56)
+		if next == '{' {
+			// go into the object so MapFacet can immediately check the keys
+			p.Cursor++
+			return p.states.mapFacet, nil
+		}
+		return p.states.scalarFacet, nil
 	}
-	return nil, nil
+	return nil, valueError(n)
 }
 
 func (p *Parser) MapFacet(n byte) (ParserState, error) {
 	// map facet keys must be (numerical) strings
 	if n != '"' {
-		return p.Object, nil
+		return p.states.object, nil
 	}
 	id, err := strconv.Atoi(p.String())
 	if err != nil {
-		return nil, err
+		return nil, newParseError(ErrFacetIndex, p.FacetPred, err)
 	}
 	p.FacetId = id
-	return p.MapFacetVal, nil
+	return p.states.mapFacetVal, nil
 }
 
 func (p *Parser) MapFacetVal(n byte) (ParserState, error) {
+	node := p.Cursor
 	// getFacet fills the p.Facet struct
 	if err := p.getFacet(n); err != nil {
 		return nil, err
 	}
-	// TODO: move this to a cache so we only have to grab referenced quads once
-	//       per facet map definition, rather than for each index-value
-	//
-	// find every quad that could be referenced by the facet
-	quads := make([]*Quad, 0)
-	for i := len(p.Quads) - 1; i >= 0; i-- {
-		if p.Quads[i].Predicate == p.FacetPred {
-			quads = append(quads, p.Quads[i])
-		}
-	}
-	for i := len(quads) - 1; i >= 0; i-- {
-		if i == len(quads)-1-p.FacetId {
-			quads[i].Facets = append(quads[i].Facets, p.Facet)
-			p.Facet = &api.Facet{}
-			return p.MapFacet, nil
-		}
-	}
-	return p.MapFacet, nil
+	// the map is keyed by the index of the quad in the predicate's array
+	quads := p.quadsFor(p.FacetPred, p.FacetLang)
+	switch {
+	case p.FacetId < 0:
+		return p.states.mapFacet, nil
+	case p.FacetId < len(quads):
+		quad := p.Quads[quads[p.FacetId]]
+		quad.Facets = append(quad.Facets, p.Facet)
+	default:
+		// the quad isn't there yet, either the facet came before the
+		// predicate or the quad is an edge that's added once its object is
+		// done
+		l := p.Levels.Object(0)
+		l.pending = append(l.pending, pendingFacet{
+			key:   predKey{p.FacetPred, p.FacetLang},
+			index: p.FacetId,
+			facet: p.Facet,
+			node:  node,
+		})
+	}
+	// the rest of the map shares this facet's key
+	key := p.Facet.Key
+	p.Facet = p.newFacet()
+	p.Facet.Key = key
+	return p.states.mapFacet, nil
 }
 
 func (p *Parser) ScalarFacet(n byte) (ParserState, error) {
+	node := p.Cursor
 	// getFacet fills the p.Facet struct
 	if err := p.getFacet(n); err != nil {
 		return nil, err
 	}
-	// because this is a scalar facet and you can reference parent quads, we
-	// first have to check if any of the quads waiting on a Level match the
-	// facet predicate
-	if p.Levels.FoundScalarFacet(p.FacetPred, p.Facet) {
-		return p.Object, nil
-	}
-	// we didn't find the predicate waiting on a Level, so go through quads
-	// in reverse order (it's most likely that the referenced quad is near
-	// the end of the p.Quads slice)
-	for i := len(p.Quads) - 1; i >= 0; i-- {
-		if p.Quads[i].Predicate == p.FacetPred {
-			p.Quads[i].Facets = append(p.Quads[i].Facets, p.Facet)
-			p.Facet = &api.Facet{}
-			return p.Object, nil
-		}
-	}
-	return p.Object, nil
+	// the current object's own quads come first (the last one, if it's an
+	// array), even if a parent's edge has the same predicate
+	if quads := p.quadsFor(p.FacetPred, p.FacetLang); len(quads) > 0 {
+		quad := p.Quads[quads[len(quads)-1]]
+		quad.Facets = append(quad.Facets, p.Facet)
+	} else if !p.hasKey(p.FacetPred, p.FacetLang) &&
+		p.Levels.FoundScalarFacet(p.FacetPred, p.FacetLang, p.Facet) {
+		// the object doesn't have the predicate at all, but you can
+		// reference parent quads, so it's the edge waiting on a Level
+		return p.states.object, nil
+	} else {
+		// the predicate hasn't shown up yet, so wait for the end of the
+		// object
+		l := p.Levels.Object(0)
+		l.pending = append(l.pending, pendingFacet{
+			key:   predKey{p.FacetPred, p.FacetLang},
+			index: -1,
+			facet: p.Facet,
+			node:  node,
+		})
+	}
+	p.Facet = p.newFacet()
+	return p.states.object, nil
 }
 
 func (p *Parser) Array(n byte) (ParserState, error) {
@@ -244,53 +429,274 @@ func (p *Parser) Array(n byte) (ParserState, error) {
 	if a.Wait != nil {
 		p.Quad.Subject = a.Wait.Subject
 		p.Quad.Predicate = a.Wait.Predicate
+		p.Quad.Lang = a.Wait.Lang
 	}
 	switch n {
 	case '{':
-		p.Levels.Deeper(false)
-		return p.Object, nil
+		// geo objects are values, so they're treated like scalars
+		if a.Wait != nil && p.isGeo() {
+			a.Scalars = true
+			if err := p.getGeoValue(); err != nil {
+				return nil, err
+			}
+			return p.states.array, nil
+		}
+		if a.Wait != nil && p.Schema != nil {
+			if err := p.checkEdge(a.Wait.Predicate); err != nil {
+				return nil, err
+			}
+		}
+		p.deeper(false)
+		return p.states.object, nil
 	case '}':
-		return p.Object, nil
+		return p.states.object, nil
 	case '[':
-		p.Levels.Deeper(false)
-		return p.Array, nil
+		p.deeper(false)
+		return p.states.array, nil
 	case ']':
+		p.Levels.Pop()
 		// return to Object rather than Array because it's the default state
-		return p.Object, nil
+		return p.states.object, nil
 	case '"', 'l', 'u', 'd', 't', 'f', 'n':
+		if a.Wait == nil {
+			// a value in the top-level array (or an array in it)
+			return nil, valueError(n)
+		}
 		a.Scalars = true
-		p.getScalarValue(n)
+		if err := p.getScalarValue(n); err != nil {
+			return nil, err
+		}
 	}
-	return p.Array, nil
+	return p.states.array, nil
 }
 
 func (p *Parser) Value(n byte) (ParserState, error) {
 	switch n {
 	case '{':
 		if p.isGeo() {
-			// TODO: add predicate to Level wait
+			// Subject and Predicate were already set by Object
 			if err := p.getGeoValue(); err != nil {
 				return nil, err
 			}
-			return p.Object, nil
+			return p.states.object, nil
+		}
+		if p.Schema != nil {
+			if err := p.checkEdge(p.Quad.Predicate); err != nil {
+				return nil, err
+			}
 		}
-		return p.openValueLevel('}', false, p.Object), nil
+		return p.openValueLevel('}', false, p.states.object), nil
 	case '[':
-		return p.openValueLevel(']', true, p.Array), nil
+		return p.openValueLevel(']', true, p.states.array), nil
 	case '"', 'l', 'u', 'd', 't', 'f', 'n':
-		p.getScalarValue(n)
+		if err := p.getScalarValue(n); err != nil {
+			return nil, err
+		}
 	}
-	return p.Object, nil
+	return p.states.object, nil
 }
 
 // Uid is called when a "uid" string is encountered within Object. Its only job
 // is to set the uid on the current (top) Level.
 func (p *Parser) Uid(n byte) (ParserState, error) {
 	if n != '"' {
-		return nil, errors.New(fmt.Sprintf("expected uid string, instead found: %c\n", n))
+		return nil, newParseError(ErrUid, "uid",
+			errors.New(fmt.Sprintf("expected uid string, instead found: %c", n)))
 	}
 	p.Levels.FoundSubject(p.String())
-	return p.Object, nil
+	return p.states.object, nil
+}
+
+// deeper is ParserLevels.Deeper, but it also remembers where the new Level's
+// quads start.
+func (p *Parser) deeper(array bool) *ParserLevel {
+	l := p.Levels.Deeper(array)
+	l.Start = len(p.Quads)
+	return l
+}
+
+// appendQuad adds a finished quad to p.Quads, and to the predicate index of
+// owner (the object Level the quad's subject belongs to) if it has one.
+func (p *Parser) appendQuad(quad *api.NQuad, owner *ParserLevel) {
+	if owner != nil && owner.indexed {
+		k := predKey{quad.Predicate, quad.Lang}
+		owner.quads[k] = append(owner.quads[k], len(p.Quads))
+		if len(owner.pending) > 0 {
+			owner.resolve(quad, k, len(owner.quads[k])-1)
+		}
+	}
+	p.Quads = append(p.Quads, quad)
+}
+
+// quadsFor returns the index (in p.Quads) of every quad of the current object
+// with the predicate and language, in order. The current object's predicate
+// index is only built the first time a facet needs it, most objects don't
+// have facets.
+func (p *Parser) quadsFor(pred, lang string) []int {
+	l := p.Levels.Object(0)
+	if l == nil {
+		return nil
+	}
+	p.index(l)
+	return l.quads[predKey{pred, lang}]
+}
+
+// hasKey looks ahead for the key pred (with lang) in the rest of the current
+// object, without moving the cursors.
+func (p *Parser) hasKey(pred, lang string) bool {
+	key := pred
+	if lang != "" {
+		key += "@" + lang
+	}
+	for i := p.Cursor + 1; i < uint64(len(p.Parsed.Tape)); {
+		if byte(p.Parsed.Tape[i]>>56) != '"' {
+			// the end of the object
+			return false
+		}
+		// compared in place, stringAt would allocate
+		offset := p.Parsed.Tape[i] & simdjson.STRINGBUFMASK
+		if string(p.Parsed.Strings[offset:offset+p.Parsed.Tape[i+1]]) == key {
+			return true
+		}
+		i = p.nextNode(i + 2)
+	}
+	return false
+}
+
+// index builds the predicate index of the object Level l, if it doesn't have
+// one yet.
+func (p *Parser) index(l *ParserLevel) {
+	if l.indexed {
+		return
+	}
+	l.indexed = true
+	if l.quads == nil {
+		l.quads = make(map[predKey][]int)
+	}
+	for i := l.Start; i < len(p.Quads); i++ {
+		// quads of nested objects have their own subjects
+		if quad := p.Quads[i]; quad.Subject == l.Subject {
+			k := predKey{quad.Predicate, quad.Lang}
+			l.quads[k] = append(l.quads[k], i)
+		}
+	}
+}
+
+// appendEdge is appendQuad for edges. A reverse edge (like "~friend") is
+// indexed under the reverse predicate, so facets can find it, and then turned
+// around: the object's subject is the subject of the edge. The index is built
+// right away, it couldn't be rebuilt from the subjects later.
+func (p *Parser) appendEdge(quad *api.NQuad, owner *ParserLevel) {
+	if !isReverse(quad.Predicate) {
+		p.appendQuad(quad, owner)
+		return
+	}
+	if owner != nil {
+		p.index(owner)
+	}
+	p.appendQuad(quad, owner)
+	quad.Predicate = quad.Predicate[1:]
+	quad.Subject, quad.ObjectId = quad.ObjectId, quad.Subject
+}
+
+// isReverse reports whether pred is a reverse predicate like "~friend".
+func isReverse(pred string) bool {
+	return len(pred) > 1 && pred[0] == '~'
+}
+
+// rename gives the object Level l a new subject, every quad of the object so
+// far is renamed (including reverse edges pointing at it).
+func (p *Parser) rename(l *ParserLevel, subject string) {
+	for _, quad := range p.Quads[l.Start:] {
+		if quad.Subject == l.Subject {
+			quad.Subject = subject
+		} else if quad.ObjectId == l.Subject {
+			quad.ObjectId = subject
+		}
+	}
+	l.Subject = subject
+}
+
+// resolvePending is called at the end of an object with facets still waiting
+// for their quads. Scalar facets go to the predicate's last quad, like they
+// would have if they came after it. Any facet whose quad never showed up is a
+// warning.
+func (p *Parser) resolvePending(l *ParserLevel) {
+	for _, f := range l.pending {
+		quads := l.quads[f.key]
+		if f.index < 0 && len(quads) > 0 {
+			quad := p.Quads[quads[len(quads)-1]]
+			quad.Facets = append(quad.Facets, f.facet)
+			continue
+		}
+		pred := f.key.pred
+		if f.key.lang != "" {
+			pred += "@" + f.key.lang
+		}
+		e := newParseError(ErrFacetPredicate, pred,
+			errors.New(fmt.Sprintf("no quad for facet: %s", f.facet.Key)))
+		p.locate(e, f.node)
+		p.Warnings = append(p.Warnings, e)
+	}
+	l.pending = l.pending[:0]
+}
+
+// deleteObject is called by Object at the end of each object in Delete mode.
+// An object with nothing but a uid deletes the whole node, unless it's the
+// object of an edge, in which case only the edge is deleted.
+func (p *Parser) deleteObject(l *ParserLevel) error {
+	if !l.Uid {
+		var pred string
+		if l.Wait != nil {
+			pred = l.Wait.Predicate
+		}
+		return newParseError(ErrDeleteUid, pred, errors.New("uid must be present while deleting"))
+	}
+	if l.Keys != 1 || l.Wait != nil {
+		return nil
+	}
+	if p.Levels.InArray() && p.Levels.Get(1).Wait != nil {
+		return nil
+	}
+	quad := p.newQuad()
+	quad.Subject = l.Subject
+	quad.Predicate = Star
+	quad.ObjectValue = &api.Value{Val: &api.Value_DefaultVal{DefaultVal: Star}}
+	p.appendQuad(quad, nil)
+	return nil
+}
+
+// splitLang splits a "name@en" key into the predicate and its language tag.
+func splitLang(key string) (string, string, error) {
+	i := strings.Index(key, "@")
+	if i < 0 {
+		return key, "", nil
+	}
+	pred, lang := key[:i], key[i+1:]
+	if pred == "" || !validLang(lang) {
+		return "", "", errors.New(fmt.Sprintf("invalid language tag in key: %s", key))
+	}
+	return pred, lang, nil
+}
+
+// validLang checks for tags like "en" or "zh-Hant-TW" (letters first, then any
+// number of alphanumeric subtags), or "." which Dgraph also accepts.
+func validLang(lang string) bool {
+	if lang == "." {
+		return true
+	}
+	for i, part := range strings.Split(lang, "-") {
+		if part == "" {
+			return false
+		}
+		for _, c := range part {
+			letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+			if !letter && (i == 0 || c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // openValueLevel is used by Value when a non-scalar value is found.
@@ -299,197 +705,204 @@ func (p *Parser) openValueLevel(closing byte, array bool, next ParserState) Pars
 	if byte(p.Parsed.Tape[p.Cursor+1]>>56) == closing {
 		// it is an empty {} or [], so skip past it
 		p.Cursor++
-		p.Iter.AdvanceInto()
 		// we always return to Object even if array = true because it's the
 		// default state where most of the work gets done
-		return p.Object
+		return p.states.object
 	}
 	// add a new level to the stack
-	l := p.Levels.Deeper(array)
+	l := p.deeper(array)
 	// the current quad is waiting until the object is done being parsed because
 	// we have to wait until we find/generate a uid
 	l.Wait = p.Quad
-	p.Quad = NewQuad()
+	p.Quad = p.newQuad()
 	// either return to Object or Array, depending on the type
 	return next
 }
 
 // getScalarValue is used by Value and Array
-func (p *Parser) getScalarValue(n byte) {
+func (p *Parser) getScalarValue(n byte) error {
+	if isReverse(p.Quad.Predicate) && (n != 'n' || p.Delete) {
+		return reverseError(p.Quad.Predicate)
+	}
+	if pred := p.predicate(p.Quad.Predicate); pred != nil && n != 'n' {
+		return p.getTypedValue(n, pred)
+	}
 	switch n {
 	case '"':
-		p.Quad.ObjectVal = p.String()
-	case 'l':
-		p.Cursor++
-		p.Quad.ObjectVal = int64(p.Parsed.Tape[p.Cursor])
+		s := p.String()
+		// only RFC 3339 strings are treated as datetimes, types.ParseTime is
+		// too eager for values (it would turn "2006" into a datetime)
+		var t time.Time
+		if err := t.UnmarshalText([]byte(s)); err == nil {
+			if p.Quad.ObjectValue, err = types.ObjectValue(types.DateTimeID, t); err != nil {
+				return newParseError(ErrValue, p.Quad.Predicate, err)
+			}
+		} else {
+			p.Quad.ObjectValue = &api.Value{Val: &api.Value_StrVal{StrVal: s}}
+		}
 	case 'u':
+		// NOTE: dgraph doesn't have a uint64 value type, and 'u' is only used
+		//       for numbers too big for an int64, so they're stored as floats
+		//       (like simdjson does)
+		p.Cursor++
+		p.Quad.ObjectValue = &api.Value{
+			Val: &api.Value_DoubleVal{DoubleVal: float64(p.Parsed.Tape[p.Cursor])},
+		}
+	case 'l':
 		p.Cursor++
-		p.Quad.ObjectVal = p.Parsed.Tape[p.Cursor]
+		p.Quad.ObjectValue = &api.Value{
+			Val: &api.Value_IntVal{IntVal: int64(p.Parsed.Tape[p.Cursor])},
+		}
 	case 'd':
 		p.Cursor++
-		p.Quad.ObjectVal = math.Float64frombits(p.Parsed.Tape[p.Cursor])
+		p.Quad.ObjectValue = &api.Value{
+			Val: &api.Value_DoubleVal{DoubleVal: math.Float64frombits(p.Parsed.Tape[p.Cursor])},
+		}
 	case 't':
-		p.Quad.ObjectVal = true
+		p.Quad.ObjectValue = &api.Value{Val: &api.Value_BoolVal{BoolVal: true}}
 	case 'f':
-		p.Quad.ObjectVal = false
+		p.Quad.ObjectValue = &api.Value{Val: &api.Value_BoolVal{BoolVal: false}}
 	case 'n':
-		p.Quad.ObjectVal = nil
+		if !p.Delete {
+			// null doesn't set anything
+			p.Quad = p.newQuad()
+			return nil
+		}
+		p.Quad.ObjectValue = &api.Value{Val: &api.Value_DefaultVal{DefaultVal: Star}}
 	}
-	p.Quads = append(p.Quads, p.Quad)
-	p.Quad = NewQuad()
+	p.appendQuad(p.Quad, p.Levels.Object(0))
+	p.Quad = p.newQuad()
+	return nil
 }
 
 func (p *Parser) getFacet(n byte) error {
-	var err error
-	var val interface{}
 	switch n {
 	case '"':
 		s := p.String()
-		t, err := types.ParseTime(s)
-		if err == nil {
+		if t, err := types.ParseTime(s); err == nil {
 			p.Facet.ValType = api.Facet_DATETIME
-			val = t
-		} else {
-			if p.Facet, err = facets.FacetFor(p.Facet.Key, strconv.Quote(s)); err != nil {
-				return err
+			if p.Facet.Value, err = t.MarshalBinary(); err != nil {
+				return newParseError(ErrFacet, p.FacetPred, err)
 			}
 			return nil
 		}
-	case 'l', 'u', 'd', 't', 'f', 'n':
-		val = p.getFacetValue(n)
-	}
-	if p.Facet, err = facets.ToBinary(p.Facet.Key, val, p.Facet.ValType); err != nil {
-		return err
+		// strings need tokens too, so they're left to dgraph
+		f, err := facets.FacetFor(p.Facet.Key, strconv.Quote(s))
+		if err != nil {
+			return newParseError(ErrFacet, p.FacetPred, err)
+		}
+		// copied, p.Facet is from the facet slab
+		*p.Facet = *f
+	case 'l', 'u', 'd', 't', 'f':
+		p.getFacetValue(n)
+	default:
+		// null, arrays and objects (inside a map facet)
+		return newParseError(ErrFacet, p.FacetPred,
+			errors.New(fmt.Sprintf("expected a scalar facet value, instead found: %c", n)))
 	}
 	return nil
 }
 
-func (p *Parser) getFacetValue(n byte) interface{} {
-	var val interface{}
+// getFacetValue sets the type and value of p.Facet for a number or a bool,
+// the value is encoded the way facets.ToBinary would.
+func (p *Parser) getFacetValue(n byte) {
+	var bits uint64
 	switch n {
 	case 'u':
-		// NOTE: dgraph doesn't have uint64 facet type, so we just convert it to
-		//       int64
-		fallthrough
+		// NOTE: dgraph doesn't have a uint64 facet type, see getScalarValue
+		p.Facet.ValType = api.Facet_FLOAT
+		p.Cursor++
+		bits = math.Float64bits(float64(p.Parsed.Tape[p.Cursor]))
 	case 'l':
 		p.Facet.ValType = api.Facet_INT
 		p.Cursor++
-		val = int64(p.Parsed.Tape[p.Cursor])
+		bits = p.Parsed.Tape[p.Cursor]
 	case 'd':
 		p.Facet.ValType = api.Facet_FLOAT
 		p.Cursor++
-		val = math.Float64frombits(p.Parsed.Tape[p.Cursor])
-	case 't':
-		p.Facet.ValType = api.Facet_BOOL
-		val = true
-	case 'f':
+		bits = p.Parsed.Tape[p.Cursor]
+	case 't', 'f':
 		p.Facet.ValType = api.Facet_BOOL
-		val = false
-	// TODO: can facets have null values?
-	case 'n':
-	}
-	return val
-}
-
-// TODO: allow "type" definition to be anywhere in the object, not just first
-func (p *Parser) isGeo() bool {
-	if uint64(len(p.Parsed.Tape))-p.Cursor < 3 {
-		return false
-	}
-	if byte(p.Parsed.Tape[p.Cursor+1]>>56) != '"' {
-		return false
-	}
-	if byte(p.Parsed.Tape[p.Cursor+3]>>56) != '"' {
-		return false
-	}
-	totalStringSize := uint64(0)
-	p.Cursor++
-	maybeGeoType := p.String()
-	totalStringSize += uint64(len(maybeGeoType))
-	if maybeGeoType != "type" {
-		p.Cursor -= 2
-		p.StringCursor -= uint64(len(maybeGeoType))
-		return false
-	}
-	p.Cursor++
-	maybeGeoType = p.String()
-	totalStringSize += uint64(len(maybeGeoType))
-	switch maybeGeoType {
-	case "Point", "MultiPoint":
-	case "LineString", "MultiLineString":
-	case "Polygon", "MultiPolygon":
-	case "GeometryCollection":
-	default:
-		p.Cursor -= 2
-		p.StringCursor -= uint64(len(maybeGeoType))
-		return false
-	}
-	p.Cursor -= 4
-	p.StringCursor -= totalStringSize
-	return true
-}
-
-func (p *Parser) getGeoValue() error {
-	// skip over the geo object
-	next := uint64(((p.Parsed.Tape[p.Cursor] << 8) >> 8) - 1)
-	stringSize := uint64(0)
-	for i := p.Cursor; i < next; i++ {
-		c := byte(p.Parsed.Tape[i] >> 56)
-		if c == '"' {
-			stringSize += p.Parsed.Tape[i+1]
+		p.Facet.Value = []byte{0}
+		if n == 't' {
+			p.Facet.Value[0] = 1
 		}
-		if c == '"' || c == 'l' || c == 'u' || c == 'd' {
-			i++
-		}
-	}
-	// adjust both cursors to the end of this object
-	p.StringCursor += stringSize
-	p.Cursor = next
-	// get an iterator only containing the geo object
-	var geoIter simdjson.Iter
-	if _, err := p.Iter.AdvanceIter(&geoIter); err != nil {
-		return err
-	}
-	// convert the geo object into json bytes
-	object, err := geoIter.MarshalJSON()
-	if err != nil {
-		return err
-	}
-	var geoStruct geom.T
-	if err = geojson.Unmarshal(object, &geoStruct); err != nil {
-		return err
-	}
-	var geoVal *api.Value
-	if geoVal, err = types.ObjectValue(types.GeoID, geoStruct); err != nil {
-		return err
+		return
 	}
-	// TODO: move everything over to *api.NQuad so we can use this *api.Value
-	_ = geoVal
-	return nil
+	p.Facet.Value = make([]byte, 8)
+	binary.LittleEndian.PutUint64(p.Facet.Value, bits)
 }
 
 type ParserLevels struct {
-	Counter uint64
-	Levels  []*ParserLevel
+	Subjects *Subjects
+	Namer    SubjectNamer
+	Levels   []*ParserLevel
 }
 
 type ParserLevel struct {
 	Array   bool
 	Subject string
-	Wait    *Quad
+	Wait    *api.NQuad
 	Scalars bool
+	// Uid is true once the object's subject came from a "uid" key rather than
+	// the Namer
+	Uid bool
+	// Keys counts every key in the object, including "uid" and facets
+	Keys int
+	// Start is how many quads the Parser had when the Level was added
+	Start int
+
+	// quads indexes the object's quads by predicate once indexed is true, see
+	// Parser.quadsFor
+	quads   map[predKey][]int
+	indexed bool
+	// pending holds facets waiting for their quad to be added
+	pending []pendingFacet
+}
+
+// pendingFacet is a facet that came before its quad. It's a map facet for the
+// quad at index in the predicate's array, or a scalar facet if index is -1.
+type pendingFacet struct {
+	key   predKey
+	index int
+	facet *api.Facet
+	// node is the tape index of the facet value, for warnings
+	node uint64
+}
+
+// resolve attaches every pending facet waiting for quad, which is number n of
+// the object's quads with the predicate k.
+func (l *ParserLevel) resolve(quad *api.NQuad, k predKey, n int) {
+	pending := l.pending[:0]
+	for _, f := range l.pending {
+		if f.key == k && f.index == n {
+			quad.Facets = append(quad.Facets, f.facet)
+			continue
+		}
+		pending = append(pending, f)
+	}
+	l.pending = pending
+}
+
+// predKey is a predicate and its language tag.
+type predKey struct {
+	pred string
+	lang string
 }
 
 func NewParserLevels() *ParserLevels {
 	return &ParserLevels{
-		Levels: make([]*ParserLevel, 0),
+		Subjects: &Subjects{},
+		Namer:    DefaultNamer,
+		Levels:   make([]*ParserLevel, 0),
 	}
 }
 
-func (p *ParserLevels) FoundScalarFacet(predicate string, facet *api.Facet) bool {
+func (p *ParserLevels) FoundScalarFacet(predicate, lang string, facet *api.Facet) bool {
 	for i := len(p.Levels) - 1; i >= 0; i-- {
-		if p.Levels[i].Wait != nil && p.Levels[i].Wait.Predicate == predicate {
-			p.Levels[i].Wait.Facets = append(p.Levels[i].Wait.Facets, facet)
+		w := p.Levels[i].Wait
+		if w != nil && w.Predicate == predicate && w.Lang == lang {
+			w.Facets = append(w.Facets, facet)
 			return true
 		}
 	}
@@ -526,18 +939,41 @@ func (p *ParserLevels) InArray() bool {
 func (p *ParserLevels) Deeper(array bool) *ParserLevel {
 	var subject string
 	if !array {
-		p.Counter++
-		// TODO: use dgraph prefix and random number
-		subject = fmt.Sprintf("c.%d", p.Counter)
+		subject = p.Namer.Name(p.Subjects.Next())
+	}
+	// reuse a Level left behind by Pop if there is one
+	var level *ParserLevel
+	if n := len(p.Levels); n < cap(p.Levels) && p.Levels[:n+1][n] != nil {
+		level = p.Levels[:n+1][n]
+	} else {
+		level = &ParserLevel{}
+	}
+	// the index and pending facets of the old Level are emptied and kept
+	quads := level.quads
+	for k := range quads {
+		delete(quads, k)
 	}
-	level := &ParserLevel{
+	*level = ParserLevel{
 		Array:   array,
 		Subject: subject,
+		quads:   quads,
+		pending: level.pending[:0],
 	}
 	p.Levels = append(p.Levels, level)
 	return level
 }
 
+// Object returns the closest object (non-array) Level, skipping the top n
+// Levels.
+func (p *ParserLevels) Object(n int) *ParserLevel {
+	for i := len(p.Levels) - 1 - n; i >= 0; i-- {
+		if !p.Levels[i].Array {
+			return p.Levels[i]
+		}
+	}
+	return nil
+}
+
 // Subject returns the current subject based on how deeply nested we are. We
 // iterate through the Levels in reverse order (it's a stack) to find a
 // non-array Level with a subject.
@@ -554,4 +990,5 @@ func (p *ParserLevels) Subject() string {
 // uid.
 func (p *ParserLevels) FoundSubject(s string) {
 	p.Levels[len(p.Levels)-1].Subject = s
+	p.Levels[len(p.Levels)-1].Uid = true
 }
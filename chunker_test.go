@@ -2,8 +2,10 @@ package chunker
 
 import (
 	"bytes"
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/dgraph-io/dgo/v2/protos/api"
@@ -32,110 +34,177 @@ func TestPrint(t *testing.T) {
 
 type Case struct {
 	Json      []byte
-	Quads     []*Quad
+	Quads     []*api.NQuad
 	ExpectErr bool
+	// Delete runs the Parser in Delete mode
+	Delete bool
 }
 
+// val wraps a Go value in the *api.Value the Parser is expected to produce for
+// it, which keeps the test cases readable.
+func val(v interface{}) *api.Value {
+	switch v := v.(type) {
+	case string:
+		return &api.Value{Val: &api.Value_StrVal{StrVal: v}}
+	case int64:
+		return &api.Value{Val: &api.Value_IntVal{IntVal: v}}
+	case float64:
+		return &api.Value{Val: &api.Value_DoubleVal{DoubleVal: v}}
+	case bool:
+		return &api.Value{Val: &api.Value_BoolVal{BoolVal: v}}
+	case nil:
+		return &api.Value{Val: &api.Value_DefaultVal{DefaultVal: Star}}
+	case time.Time:
+		b, _ := v.MarshalBinary()
+		return &api.Value{Val: &api.Value_DatetimeVal{DatetimeVal: b}}
+	}
+	return nil
+}
+
+// Test runs the case through both simdjson and the encoding/json fallback,
+// which have to produce identical quads.
 func (c *Case) Test(t *testing.T, logs bool) {
-	p := NewParser()
-	err := p.Run(c.Json)
-	if err != nil {
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		p.Delete = c.Delete
+		err := p.Run(c.Json)
+		if err != nil {
+			if c.ExpectErr {
+				continue
+			}
+			t.Fatal(err)
+		}
 		if c.ExpectErr {
-			return
+			t.Fatalf("expected an error (fallback: %v)", fallback)
 		}
-		t.Fatal(err)
+		checkQuads(t, p.Quads, c.Quads)
 	}
-	quads := p.Quads
-	if c.ExpectErr {
-		t.Fatalf("expected an error")
-	}
-	if len(quads) != len(c.Quads) {
-		t.Fatalf("expected %d quads but got %d\n", len(c.Quads), len(quads))
+}
+
+// checkQuads fails the test if quads doesn't match the expected quads.
+func checkQuads(t *testing.T, quads, expected []*api.NQuad) {
+	t.Helper()
+	if len(quads) != len(expected) {
+		t.Fatalf("expected %d quads but got %d\n", len(expected), len(quads))
 	}
 	for i, quad := range quads {
-		if quad.Subject != c.Quads[i].Subject {
+		if quad.Subject != expected[i].Subject {
 			spew.Dump(quad)
 			t.Fatalf("expected '%s' subject for quad %d but got '%s'\n",
-				c.Quads[i].Subject, i, quad.Subject)
+				expected[i].Subject, i, quad.Subject)
 		}
-		if quad.Predicate != c.Quads[i].Predicate {
+		if quad.Predicate != expected[i].Predicate {
 			spew.Dump(quad)
 			t.Fatalf("expected '%s' predicate for quad %d but got '%s'\n",
-				c.Quads[i].Predicate, i, quad.Predicate)
+				expected[i].Predicate, i, quad.Predicate)
 		}
-		if quad.ObjectId != c.Quads[i].ObjectId {
+		if quad.Lang != expected[i].Lang {
+			spew.Dump(quad)
+			t.Fatalf("expected '%s' lang for quad %d but got '%s'\n",
+				expected[i].Lang, i, quad.Lang)
+		}
+		if quad.ObjectId != expected[i].ObjectId {
 			spew.Dump(quad)
 			t.Fatalf("expected '%s' objectId for quad %d but got '%s'\n",
-				c.Quads[i].ObjectId, i, quad.ObjectId)
+				expected[i].ObjectId, i, quad.ObjectId)
 		}
-		if quad.ObjectVal == nil && c.Quads[i].ObjectVal == nil {
+		if quad.ObjectValue == nil && expected[i].ObjectValue == nil {
 			continue
 		}
+		if quad.ObjectValue == nil || expected[i].ObjectValue == nil {
+			spew.Dump(quad)
+			t.Fatalf("expected %v objectValue for quad %d but got %v\n",
+				expected[i].ObjectValue, i, quad.ObjectValue)
+		}
 		// make sure the values are of the same type
-		valType := reflect.TypeOf(quad.ObjectVal).String()
-		correctValType := reflect.TypeOf(c.Quads[i].ObjectVal).String()
+		valType := reflect.TypeOf(quad.ObjectValue.Val).String()
+		correctValType := reflect.TypeOf(expected[i].ObjectValue.Val).String()
 		if valType != correctValType {
 			spew.Dump(quad)
-			t.Fatalf("expected %s objectVal for quad %d but got %s\n",
+			t.Fatalf("expected %s objectValue for quad %d but got %s\n",
 				correctValType, i, valType)
 		}
 		// make sure the values are equal
 		switch correctValType {
-		case "string":
-			if quad.ObjectVal.(string) != c.Quads[i].ObjectVal.(string) {
-				t.Fatalf("expected '%s' objectVal for quad %d but got '%s'\n",
-					c.Quads[i].ObjectVal.(string), i, quad.ObjectVal.(string))
+		case "*api.Value_StrVal":
+			if quad.ObjectValue.GetStrVal() != expected[i].ObjectValue.GetStrVal() {
+				t.Fatalf("expected '%s' objectValue for quad %d but got '%s'\n",
+					expected[i].ObjectValue.GetStrVal(), i, quad.ObjectValue.GetStrVal())
+			}
+		case "*api.Value_IntVal":
+			if quad.ObjectValue.GetIntVal() != expected[i].ObjectValue.GetIntVal() {
+				t.Fatalf("expected %d objectValue for quad %d but got %d\n",
+					expected[i].ObjectValue.GetIntVal(), i, quad.ObjectValue.GetIntVal())
+			}
+		case "*api.Value_DoubleVal":
+			if quad.ObjectValue.GetDoubleVal() != expected[i].ObjectValue.GetDoubleVal() {
+				t.Fatalf("expected %f objectValue for quad %s but got %f\n",
+					expected[i].ObjectValue.GetDoubleVal(), quad.Subject,
+					quad.ObjectValue.GetDoubleVal())
+			}
+		case "*api.Value_BoolVal":
+			if quad.ObjectValue.GetBoolVal() != expected[i].ObjectValue.GetBoolVal() {
+				t.Fatalf("expected %v objectValue for quad %d got %v\n",
+					expected[i].ObjectValue.GetBoolVal(), i, quad.ObjectValue.GetBoolVal())
 			}
-		case "int64":
-			if quad.ObjectVal.(int64) != c.Quads[i].ObjectVal.(int64) {
-				t.Fatalf("expected %d objectVal for quad %d but got %d\n",
-					c.Quads[i].ObjectVal.(int64), i, quad.ObjectVal.(int64))
+		case "*api.Value_DefaultVal":
+			if quad.ObjectValue.GetDefaultVal() != expected[i].ObjectValue.GetDefaultVal() {
+				t.Fatalf("expected '%s' objectValue for quad %d got '%s'\n",
+					expected[i].ObjectValue.GetDefaultVal(), i, quad.ObjectValue.GetDefaultVal())
 			}
-		case "uint64":
-			if quad.ObjectVal.(uint64) != c.Quads[i].ObjectVal.(uint64) {
-				t.Fatalf("expected %d objectVal for quad %d but got %d\n",
-					c.Quads[i].ObjectVal.(uint64), i, quad.ObjectVal.(uint64))
+		case "*api.Value_DatetimeVal":
+			if !bytes.Equal(quad.ObjectValue.GetDatetimeVal(),
+				expected[i].ObjectValue.GetDatetimeVal()) {
+				t.Fatalf("expected %v objectValue for quad %d got %v\n",
+					expected[i].ObjectValue.GetDatetimeVal(), i,
+					quad.ObjectValue.GetDatetimeVal())
 			}
-		case "float64":
-			if quad.ObjectVal.(float64) != c.Quads[i].ObjectVal.(float64) {
-				t.Fatalf("expected %f objectVal for quad %s but got %f\n",
-					c.Quads[i].ObjectVal.(float64), quad.Subject, quad.ObjectVal.(float64))
+		case "*api.Value_GeoVal":
+			if !bytes.Equal(quad.ObjectValue.GetGeoVal(), expected[i].ObjectValue.GetGeoVal()) {
+				t.Fatalf("expected %v objectValue for quad %d got %v\n",
+					expected[i].ObjectValue.GetGeoVal(), i, quad.ObjectValue.GetGeoVal())
 			}
-		case "bool":
-			if quad.ObjectVal.(bool) != c.Quads[i].ObjectVal.(bool) {
-				t.Fatalf("expected %v objectVal for quad %d got %v\n",
-					c.Quads[i].ObjectVal.(bool), i, quad.ObjectVal.(bool))
+		case "*api.Value_PasswordVal":
+			if quad.ObjectValue.GetPasswordVal() != expected[i].ObjectValue.GetPasswordVal() {
+				t.Fatalf("expected '%s' objectValue for quad %d got '%s'\n",
+					expected[i].ObjectValue.GetPasswordVal(), i, quad.ObjectValue.GetPasswordVal())
 			}
 		default:
-			t.Fatal("objectVal type not handled")
+			t.Fatal("objectValue type not handled")
 		}
 		// check facets
-		if len(c.Quads[i].Facets) > 0 {
+		if len(expected[i].Facets) > 0 {
 			if quad.Facets == nil || len(quad.Facets) == 0 {
 				t.Fatalf("expected facets for quad %d, but found none\n", i)
 			}
 			for j, facet := range quad.Facets {
-				if facet.ValType != c.Quads[i].Facets[j].ValType {
+				if facet.Key != expected[i].Facets[j].Key {
 					spew.Dump(facet)
-					spew.Dump(c.Quads[i].Facets[j])
+					t.Fatalf("expected '%s' key for quad %d facet %d but got '%s'\n",
+						expected[i].Facets[j].Key, i, j, facet.Key)
+				}
+				if facet.ValType != expected[i].Facets[j].ValType {
+					spew.Dump(facet)
+					spew.Dump(expected[i].Facets[j])
 					t.Fatalf("expected %s valType for quad %d facet %d but got %s\n",
-						c.Quads[i].Facets[j].ValType.String(), i, j, facet.ValType.String())
+						expected[i].Facets[j].ValType.String(), i, j, facet.ValType.String())
 				}
-				if !bytes.Equal(facet.Value, c.Quads[i].Facets[j].Value) {
+				if !bytes.Equal(facet.Value, expected[i].Facets[j].Value) {
 					spew.Dump(facet)
 					t.Fatalf("expected %v value for quad %d facet %d but got %v\n",
-						c.Quads[i].Facets[j].Value, i, j, facet.Value)
+						expected[i].Facets[j].Value, i, j, facet.Value)
 				}
 				// check facet tokens
-				if len(c.Quads[i].Facets[j].Tokens) > 0 {
+				if len(expected[i].Facets[j].Tokens) > 0 {
 					if facet.Tokens == nil || len(facet.Tokens) == 0 {
 						t.Fatalf("expected tokens for quad %d facet %d but found none\n",
 							i, j)
 					}
 					for k, token := range facet.Tokens {
-						if token != c.Quads[i].Facets[j].Tokens[k] {
+						if token != expected[i].Facets[j].Tokens[k] {
 							t.Fatalf("expected token '%s' for quad %d facet %d but found '%s'\n",
-								c.Quads[i].Facets[j].Tokens[k], i, j, token)
+								expected[i].Facets[j].Tokens[k], i, j, token)
 						}
 					}
 				}
@@ -153,10 +222,10 @@ func TestNumbers(t *testing.T) {
 				"uid": "1",
 				"key": 9223372036854775299
 			}`),
-			Quads: []*Quad{{
-				Subject:   "1",
-				Predicate: "key",
-				ObjectVal: int64(9223372036854775299),
+			Quads: []*api.NQuad{{
+				Subject:     "1",
+				Predicate:   "key",
+				ObjectValue: val(int64(9223372036854775299)),
 			}},
 		},
 		{
@@ -164,10 +233,10 @@ func TestNumbers(t *testing.T) {
 				"uid": "2",
 				"key": 9223372036854775299.0
 			}`),
-			Quads: []*Quad{{
-				Subject:   "2",
-				Predicate: "key",
-				ObjectVal: float64(9223372036854775299.0),
+			Quads: []*api.NQuad{{
+				Subject:     "2",
+				Predicate:   "key",
+				ObjectValue: val(float64(9223372036854775299.0)),
 			}},
 		},
 		{
@@ -182,10 +251,10 @@ func TestNumbers(t *testing.T) {
 				"uid": "4",
 				"key": "23452786"
 			}`),
-			Quads: []*Quad{{
-				Subject:   "4",
-				Predicate: "key",
-				ObjectVal: "23452786",
+			Quads: []*api.NQuad{{
+				Subject:     "4",
+				Predicate:   "key",
+				ObjectValue: val("23452786"),
 			}},
 		},
 		{
@@ -193,10 +262,10 @@ func TestNumbers(t *testing.T) {
 				"uid": "5",
 				"key": "23452786.2378"
 			}`),
-			Quads: []*Quad{{
-				Subject:   "5",
-				Predicate: "key",
-				ObjectVal: "23452786.2378",
+			Quads: []*api.NQuad{{
+				Subject:     "5",
+				Predicate:   "key",
+				ObjectValue: val("23452786.2378"),
 			}},
 		},
 		{
@@ -204,10 +273,10 @@ func TestNumbers(t *testing.T) {
 				"uid": "6",
 				"key": -1e10
 			}`),
-			Quads: []*Quad{{
-				Subject:   "6",
-				Predicate: "key",
-				ObjectVal: float64(-1e+10),
+			Quads: []*api.NQuad{{
+				Subject:     "6",
+				Predicate:   "key",
+				ObjectValue: val(float64(-1e+10)),
 			}},
 		},
 		{
@@ -215,10 +284,10 @@ func TestNumbers(t *testing.T) {
 				"uid": "7",
 				"key": 0E-0
 			}`),
-			Quads: []*Quad{{
-				Subject:   "7",
-				Predicate: "key",
-				ObjectVal: float64(0),
+			Quads: []*api.NQuad{{
+				Subject:     "7",
+				Predicate:   "key",
+				ObjectValue: val(float64(0)),
 			}},
 		},
 	}
@@ -227,6 +296,63 @@ func TestNumbers(t *testing.T) {
 	}
 }
 
+// TestNumbersUint checks numbers too big for an int64 end up floats, which
+// is what simdjson makes of them (the fallback has them as uint64s).
+func TestNumbersUint(t *testing.T) {
+	c := &Case{
+		Json: []byte(`{
+			"uid": "1",
+			"key": 18446744073709551615,
+			"key|max": 18446744073709551615
+		}`),
+		Quads: []*api.NQuad{{
+			Subject:     "1",
+			Predicate:   "key",
+			ObjectValue: val(float64(18446744073709551615)),
+			Facets: []*api.Facet{{
+				Key:     "max",
+				ValType: api.Facet_FLOAT,
+				Value: []byte{
+					0x00, 0x00, 0x00, 0x00,
+					0x00, 0x00, 0xf0, 0x43,
+				},
+			}},
+		}},
+	}
+	c.Test(t, false)
+}
+
+func TestValues(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339Nano, "2020-12-29T17:39:34.816808024Z")
+	c := &Case{
+		Json: []byte(`{
+			"uid": "1",
+			"now": "2020-12-29T17:39:34.816808024Z",
+			"year": "2006",
+			"married": true,
+			"count": 12
+		}`),
+		Quads: []*api.NQuad{{
+			Subject:     "1",
+			Predicate:   "now",
+			ObjectValue: val(now),
+		}, {
+			Subject:     "1",
+			Predicate:   "year",
+			ObjectValue: val("2006"),
+		}, {
+			Subject:     "1",
+			Predicate:   "married",
+			ObjectValue: val(true),
+		}, {
+			Subject:     "1",
+			Predicate:   "count",
+			ObjectValue: val(int64(12)),
+		}},
+	}
+	c.Test(t, false)
+}
+
 func TestFacetsScalar(t *testing.T) {
 	c := &Case{
 		Json: []byte(`[{
@@ -239,16 +365,16 @@ func TestFacetsScalar(t *testing.T) {
 			"car|price": 30000.56,
 			"car|since": "2006-01-02T15:04:05Z"
 		}]`),
-		Quads: []*Quad{{
-			Subject:   "c.1",
-			Predicate: "name",
-			ObjectId:  "",
-			ObjectVal: "Alice",
-		}, {
-			Subject:   "c.1",
-			Predicate: "mobile",
-			ObjectId:  "",
-			ObjectVal: "040123456",
+		Quads: []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectId:    "",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "mobile",
+			ObjectId:    "",
+			ObjectValue: val("040123456"),
 			Facets: []*api.Facet{{
 				Key:     "operation",
 				ValType: api.Facet_STRING,
@@ -256,10 +382,10 @@ func TestFacetsScalar(t *testing.T) {
 				Tokens:  []string{"\x01read", "\x01write"},
 			}},
 		}, {
-			Subject:   "c.1",
-			Predicate: "car",
-			ObjectId:  "",
-			ObjectVal: "MA0123",
+			Subject:     "_:c.1",
+			Predicate:   "car",
+			ObjectId:    "",
+			ObjectValue: val("MA0123"),
 			Facets: []*api.Facet{{
 				Key:     "first",
 				ValType: api.Facet_BOOL,
@@ -307,14 +433,14 @@ func TestFacetsMap(t *testing.T) {
 				"2": 21
 			}
 		}]`),
-		Quads: []*Quad{{
-			Subject:   "c.1",
-			Predicate: "name",
-			ObjectVal: "Alice",
+		Quads: []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectValue: val("Alice"),
 		}, {
-			Subject:   "c.1",
-			Predicate: "friend",
-			ObjectVal: "Joshua",
+			Subject:     "_:c.1",
+			Predicate:   "friend",
+			ObjectValue: val("Joshua"),
 			Facets: []*api.Facet{{
 				Key:     "from",
 				ValType: api.Facet_STRING,
@@ -322,9 +448,9 @@ func TestFacetsMap(t *testing.T) {
 				Tokens:  []string{"\x01school"},
 			}},
 		}, {
-			Subject:   "c.1",
-			Predicate: "friend",
-			ObjectVal: "David",
+			Subject:     "_:c.1",
+			Predicate:   "friend",
+			ObjectValue: val("David"),
 			Facets: []*api.Facet{{
 				Key:     "age",
 				ValType: api.Facet_INT,
@@ -334,9 +460,9 @@ func TestFacetsMap(t *testing.T) {
 				},
 			}},
 		}, {
-			Subject:   "c.1",
-			Predicate: "friend",
-			ObjectVal: "Josh",
+			Subject:     "_:c.1",
+			Predicate:   "friend",
+			ObjectValue: val("Josh"),
 			Facets: []*api.Facet{{
 				Key:     "from",
 				ValType: api.Facet_STRING,
@@ -355,6 +481,188 @@ func TestFacetsMap(t *testing.T) {
 	c.Test(t, true)
 }
 
+func TestFacetsMapObjects(t *testing.T) {
+	// map facet indexes only count the quads of the object they're in
+	c := &Case{
+		Json: []byte(`[
+			{"uid": "0x1", "friend": ["Alice", "Bob"]},
+			{"uid": "0x2", "friend": ["Charlie"], "friend|close": {"0": true}}
+		]`),
+		Quads: []*api.NQuad{{
+			Subject:     "0x1",
+			Predicate:   "friend",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "0x1",
+			Predicate:   "friend",
+			ObjectValue: val("Bob"),
+		}, {
+			Subject:     "0x2",
+			Predicate:   "friend",
+			ObjectValue: val("Charlie"),
+			Facets: []*api.Facet{{
+				Key:     "close",
+				ValType: api.Facet_BOOL,
+				Value:   []byte{0x01},
+			}},
+		}},
+	}
+	c.Test(t, false)
+	for _, quad := range c.Quads[:2] {
+		if len(quad.Facets) != 0 {
+			t.Fatal("expected no facets on 0x1's quads")
+		}
+	}
+}
+
+func TestFacetsMapEdges(t *testing.T) {
+	since := func(year int64) *api.Facet {
+		return &api.Facet{
+			Key:     "since",
+			ValType: api.Facet_INT,
+			Value:   []byte{byte(year), byte(year >> 8), 0, 0, 0, 0, 0, 0},
+		}
+	}
+	closed := &api.Facet{Key: "close", ValType: api.Facet_BOOL, Value: []byte{0x01}}
+	expected := []*api.NQuad{{
+		Subject:   "0x1",
+		Predicate: "friend",
+		ObjectId:  "0x2",
+		Facets:    []*api.Facet{closed, since(2019)},
+	}, {
+		Subject:   "0x1",
+		Predicate: "friend",
+		ObjectId:  "0x3",
+		Facets:    []*api.Facet{closed, since(2020)},
+	}}
+	// the map facet works before and after the array of objects
+	for _, d := range []string{`{
+		"uid": "0x1",
+		"friend|since": {"0": 2019, "1": 2020},
+		"friend": [{"uid": "0x2", "friend|close": true}, {"uid": "0x3"}]
+	}`, `{
+		"uid": "0x1",
+		"friend": [{"uid": "0x2", "friend|close": true}, {"uid": "0x3"}],
+		"friend|since": {"0": 2019, "1": 2020}
+	}`} {
+		c := &Case{Json: []byte(d), Quads: expected}
+		c.Test(t, false)
+	}
+}
+
+func TestFacetsBefore(t *testing.T) {
+	closed := &api.Facet{Key: "close", ValType: api.Facet_BOOL, Value: []byte{0x01}}
+	c := &Case{
+		Json: []byte(`{
+			"uid": "0x1",
+			"name|source": "passport",
+			"name@en|source": "visa",
+			"friend|close": true,
+			"name": "Alice",
+			"name@en": "Alice",
+			"friend": {"uid": "0x2"}
+		}`),
+		Quads: []*api.NQuad{{
+			Subject:     "0x1",
+			Predicate:   "name",
+			ObjectValue: val("Alice"),
+			Facets: []*api.Facet{{
+				Key:     "source",
+				ValType: api.Facet_STRING,
+				Value:   []byte("passport"),
+			}},
+		}, {
+			Subject:     "0x1",
+			Predicate:   "name",
+			Lang:        "en",
+			ObjectValue: val("Alice"),
+			Facets: []*api.Facet{{
+				Key:     "source",
+				ValType: api.Facet_STRING,
+				Value:   []byte("visa"),
+			}},
+		}, {
+			Subject:   "0x1",
+			Predicate: "friend",
+			ObjectId:  "0x2",
+			Facets:    []*api.Facet{closed},
+		}},
+	}
+	c.Test(t, false)
+}
+
+// TestFacetsBeforeOwn checks a facet before its predicate goes on the
+// object's own quad, rather than the parent's edge with the same predicate.
+func TestFacetsBeforeOwn(t *testing.T) {
+	closed := &api.Facet{Key: "close", ValType: api.Facet_BOOL, Value: []byte{0x01}}
+	c := &Case{
+		Json: []byte(`{
+			"uid": "0x1",
+			"friend": {
+				"uid": "0x2",
+				"friend|close": true,
+				"friend": "bob"
+			}
+		}`),
+		Quads: []*api.NQuad{{
+			Subject:     "0x2",
+			Predicate:   "friend",
+			ObjectValue: val("bob"),
+			Facets:      []*api.Facet{closed},
+		}, {
+			Subject:   "0x1",
+			Predicate: "friend",
+			ObjectId:  "0x2",
+		}},
+	}
+	c.Test(t, false)
+}
+
+func TestReverse(t *testing.T) {
+	closed := &api.Facet{Key: "close", ValType: api.Facet_BOOL, Value: []byte{0x01}}
+	c := &Case{
+		Json: []byte(`{
+			"uid": "0x1",
+			"~friend": [{"uid": "0x2", "name": "Bob"}, {"name": "Charlie"}],
+			"~friend|close": {"1": true},
+			"~boss": {"uid": "0x4", "~boss|close": true},
+			"~pet": null
+		}`),
+		Quads: []*api.NQuad{{
+			Subject:     "0x2",
+			Predicate:   "name",
+			ObjectValue: val("Bob"),
+		}, {
+			Subject:   "0x2",
+			Predicate: "friend",
+			ObjectId:  "0x1",
+		}, {
+			Subject:     "_:c.3",
+			Predicate:   "name",
+			ObjectValue: val("Charlie"),
+		}, {
+			Subject:   "_:c.3",
+			Predicate: "friend",
+			ObjectId:  "0x1",
+			Facets:    []*api.Facet{closed},
+		}, {
+			Subject:   "0x4",
+			Predicate: "boss",
+			ObjectId:  "0x1",
+			Facets:    []*api.Facet{closed},
+		}},
+	}
+	c.Test(t, false)
+	for _, d := range []string{
+		`{"~friend": "Bob"}`,
+		`{"~friend": ["Bob"]}`,
+		`{"~home": {"type": "Point", "coordinates": [1, 2]}}`,
+	} {
+		c := &Case{Json: []byte(d), ExpectErr: true}
+		c.Test(t, false)
+	}
+}
+
 func Test1(t *testing.T) {
 	c := &Case{
 		Json: []byte(`{
@@ -372,36 +680,36 @@ func Test1(t *testing.T) {
 				}
 			]
 		}`),
-		Quads: []*Quad{{
-			Subject:   "c.1",
-			Predicate: "name",
-			ObjectId:  "",
-			ObjectVal: "Alice",
-		}, {
-			Subject:   "c.2",
-			Predicate: "name",
-			ObjectId:  "",
-			ObjectVal: "Charlie",
-		}, {
-			Subject:   "c.2",
-			Predicate: "married",
-			ObjectId:  "",
-			ObjectVal: false,
-		}, {
-			Subject:   "c.1",
-			Predicate: "friend",
-			ObjectId:  "c.2",
-			ObjectVal: nil,
+		Quads: []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectId:    "",
+			ObjectValue: val("Alice"),
 		}, {
-			Subject:   "1000",
-			Predicate: "name",
-			ObjectId:  "",
-			ObjectVal: "Bob",
+			Subject:     "_:c.2",
+			Predicate:   "name",
+			ObjectId:    "",
+			ObjectValue: val("Charlie"),
 		}, {
-			Subject:   "c.1",
-			Predicate: "friend",
-			ObjectId:  "1000",
-			ObjectVal: nil,
+			Subject:     "_:c.2",
+			Predicate:   "married",
+			ObjectId:    "",
+			ObjectValue: val(false),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "friend",
+			ObjectId:    "_:c.2",
+			ObjectValue: nil,
+		}, {
+			Subject:     "1000",
+			Predicate:   "name",
+			ObjectId:    "",
+			ObjectValue: val("Bob"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "friend",
+			ObjectId:    "1000",
+			ObjectValue: nil,
 		}},
 	}
 	c.Test(t, false)
@@ -416,21 +724,21 @@ func Test2(t *testing.T) {
 				"name": "Wellington Public School"
 			}
 		}`),
-		Quads: []*Quad{{
-			Subject:   "c.1",
-			Predicate: "name",
-			ObjectId:  "",
-			ObjectVal: "Alice",
-		}, {
-			Subject:   "c.2",
-			Predicate: "name",
-			ObjectId:  "",
-			ObjectVal: "Wellington Public School",
-		}, {
-			Subject:   "c.1",
-			Predicate: "school",
-			ObjectId:  "c.2",
-			ObjectVal: nil,
+		Quads: []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectId:    "",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "_:c.2",
+			Predicate:   "name",
+			ObjectId:    "",
+			ObjectValue: val("Wellington Public School"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "school",
+			ObjectId:    "_:c.2",
+			ObjectValue: nil,
 		}},
 	}
 	c.Test(t, false)
@@ -447,31 +755,31 @@ func Test3(t *testing.T) {
 				"weight": 58.7
 			}
 		]`),
-		Quads: []*Quad{{
-			Subject:   "c.1",
-			Predicate: "name",
-			ObjectId:  "",
-			ObjectVal: "Alice",
-		}, {
-			Subject:   "c.1",
-			Predicate: "mobile",
-			ObjectId:  "",
-			ObjectVal: "040123456",
-		}, {
-			Subject:   "c.1",
-			Predicate: "car",
-			ObjectId:  "",
-			ObjectVal: "MA0123",
-		}, {
-			Subject:   "c.1",
-			Predicate: "age",
-			ObjectId:  "",
-			ObjectVal: int64(21),
-		}, {
-			Subject:   "c.1",
-			Predicate: "weight",
-			ObjectId:  "",
-			ObjectVal: float64(58.7),
+		Quads: []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectId:    "",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "mobile",
+			ObjectId:    "",
+			ObjectValue: val("040123456"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "car",
+			ObjectId:    "",
+			ObjectValue: val("MA0123"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "age",
+			ObjectId:    "",
+			ObjectValue: val(int64(21)),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "weight",
+			ObjectId:    "",
+			ObjectValue: val(float64(58.7)),
 		}},
 	}
 	c.Test(t, false)
@@ -488,26 +796,26 @@ func Test4(t *testing.T) {
 				}
 			]
 		}`),
-		Quads: []*Quad{{
-			Subject:   "c.1",
-			Predicate: "name",
-			ObjectId:  "",
-			ObjectVal: "Alice",
-		}, {
-			Subject:   "c.1",
-			Predicate: "age",
-			ObjectId:  "",
-			ObjectVal: int64(25),
-		}, {
-			Subject:   "c.2",
-			Predicate: "name",
-			ObjectId:  "",
-			ObjectVal: "Bob",
-		}, {
-			Subject:   "c.1",
-			Predicate: "friends",
-			ObjectId:  "c.2",
-			ObjectVal: nil,
+		Quads: []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectId:    "",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "age",
+			ObjectId:    "",
+			ObjectValue: val(int64(25)),
+		}, {
+			Subject:     "_:c.2",
+			Predicate:   "name",
+			ObjectId:    "",
+			ObjectValue: val("Bob"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "friends",
+			ObjectId:    "_:c.2",
+			ObjectValue: nil,
 		}},
 	}
 	c.Test(t, false)
@@ -520,26 +828,26 @@ func Test5(t *testing.T) {
 			"friends": ["Bob", "Josh"],
 			"ages": [26, 33.2]
 		}]`),
-		Quads: []*Quad{{
-			Subject:   "c.1",
-			Predicate: "name",
-			ObjectVal: "Alice",
-		}, {
-			Subject:   "c.1",
-			Predicate: "friends",
-			ObjectVal: "Bob",
-		}, {
-			Subject:   "c.1",
-			Predicate: "friends",
-			ObjectVal: "Josh",
-		}, {
-			Subject:   "c.1",
-			Predicate: "ages",
-			ObjectVal: int64(26),
-		}, {
-			Subject:   "c.1",
-			Predicate: "ages",
-			ObjectVal: float64(33.2),
+		Quads: []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "friends",
+			ObjectValue: val("Bob"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "friends",
+			ObjectValue: val("Josh"),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "ages",
+			ObjectValue: val(int64(26)),
+		}, {
+			Subject:     "_:c.1",
+			Predicate:   "ages",
+			ObjectValue: val(float64(33.2)),
 		}},
 	}
 	c.Test(t, false)
@@ -605,38 +913,187 @@ func Test6(t *testing.T) {
 			]
 		  }
 		]`),
-		Quads: []*Quad{
-			{"c.1", "name", "", "A", nil},
-			{"c.1", "age", "", int64(25), nil},
-			{"c.2", "name", "", "A1", nil},
-			{"c.3", "name", "", "A11", nil},
-			{"c.2", "friends", "c.3", nil, nil},
-			{"c.4", "name", "", "A12", nil},
-			{"c.2", "friends", "c.4", nil, nil},
-			{"c.1", "friends", "c.2", nil, nil},
-			{"c.5", "name", "", "A2", nil},
-			{"c.6", "name", "", "A21", nil},
-			{"c.5", "friends", "c.6", nil, nil},
-			{"c.7", "name", "", "A22", nil},
-			{"c.5", "friends", "c.7", nil, nil},
-			{"c.1", "friends", "c.5", nil, nil},
-			{"c.8", "name", "", "B", nil},
-			{"c.8", "age", "", int64(26), nil},
-			{"c.9", "name", "", "B1", nil},
-			{"c.10", "name", "", "B11", nil},
-			{"c.9", "friends", "c.10", nil, nil},
-			{"c.11", "name", "", "B12", nil},
-			{"c.9", "friends", "c.11", nil, nil},
-			{"c.8", "friends", "c.9", nil, nil},
-			{"c.12", "name", "", "B2", nil},
-			{"c.13", "name", "", "B21", nil},
-			{"c.12", "friends", "c.13", nil, nil},
-			{"c.14", "name", "", "B22", nil},
-			{"c.12", "friends", "c.14", nil, nil},
-			{"c.8", "friends", "c.12", nil, nil},
+		Quads: []*api.NQuad{
+			{Subject: "_:c.1", Predicate: "name", ObjectValue: val("A")},
+			{Subject: "_:c.1", Predicate: "age", ObjectValue: val(int64(25))},
+			{Subject: "_:c.2", Predicate: "name", ObjectValue: val("A1")},
+			{Subject: "_:c.3", Predicate: "name", ObjectValue: val("A11")},
+			{Subject: "_:c.2", Predicate: "friends", ObjectId: "_:c.3"},
+			{Subject: "_:c.4", Predicate: "name", ObjectValue: val("A12")},
+			{Subject: "_:c.2", Predicate: "friends", ObjectId: "_:c.4"},
+			{Subject: "_:c.1", Predicate: "friends", ObjectId: "_:c.2"},
+			{Subject: "_:c.5", Predicate: "name", ObjectValue: val("A2")},
+			{Subject: "_:c.6", Predicate: "name", ObjectValue: val("A21")},
+			{Subject: "_:c.5", Predicate: "friends", ObjectId: "_:c.6"},
+			{Subject: "_:c.7", Predicate: "name", ObjectValue: val("A22")},
+			{Subject: "_:c.5", Predicate: "friends", ObjectId: "_:c.7"},
+			{Subject: "_:c.1", Predicate: "friends", ObjectId: "_:c.5"},
+			{Subject: "_:c.8", Predicate: "name", ObjectValue: val("B")},
+			{Subject: "_:c.8", Predicate: "age", ObjectValue: val(int64(26))},
+			{Subject: "_:c.9", Predicate: "name", ObjectValue: val("B1")},
+			{Subject: "_:c.10", Predicate: "name", ObjectValue: val("B11")},
+			{Subject: "_:c.9", Predicate: "friends", ObjectId: "_:c.10"},
+			{Subject: "_:c.11", Predicate: "name", ObjectValue: val("B12")},
+			{Subject: "_:c.9", Predicate: "friends", ObjectId: "_:c.11"},
+			{Subject: "_:c.8", Predicate: "friends", ObjectId: "_:c.9"},
+			{Subject: "_:c.12", Predicate: "name", ObjectValue: val("B2")},
+			{Subject: "_:c.13", Predicate: "name", ObjectValue: val("B21")},
+			{Subject: "_:c.12", Predicate: "friends", ObjectId: "_:c.13"},
+			{Subject: "_:c.14", Predicate: "name", ObjectValue: val("B22")},
+			{Subject: "_:c.12", Predicate: "friends", ObjectId: "_:c.14"},
+			{Subject: "_:c.8", Predicate: "friends", ObjectId: "_:c.12"},
+		},
+	}
+	c.Test(t, false)
+}
+
+// scalar arrays nested in an array of objects
+func Test7(t *testing.T) {
+	c := &Case{
+		Json: []byte(`{
+			"name": "Alice",
+			"friend": [
+				{
+					"uid": "0x1f"
+				},
+				{
+					"name": "Bob",
+					"nickname": ["Bobby", "Rob"]
+				}
+			]
+		}`),
+		Quads: []*api.NQuad{
+			{Subject: "_:c.1", Predicate: "name", ObjectValue: val("Alice")},
+			{Subject: "_:c.1", Predicate: "friend", ObjectId: "0x1f"},
+			{Subject: "_:c.3", Predicate: "name", ObjectValue: val("Bob")},
+			{Subject: "_:c.3", Predicate: "nickname", ObjectValue: val("Bobby")},
+			{Subject: "_:c.3", Predicate: "nickname", ObjectValue: val("Rob")},
+			{Subject: "_:c.1", Predicate: "friend", ObjectId: "_:c.3"},
+		},
+	}
+	c.Test(t, false)
+}
+
+func TestLang(t *testing.T) {
+	c := &Case{
+		Json: []byte(`{
+			"name": "Alice",
+			"name@en": "Alice",
+			"name@zh-Hant-TW": "愛麗絲",
+			"nickname@en": ["Al", "Ali"],
+			"name@en|source": "passport",
+			"nickname@en|since": {
+				"1": 2006
+			}
+		}`),
+		Quads: []*api.NQuad{
+			{Subject: "_:c.1", Predicate: "name", ObjectValue: val("Alice")},
+			{Subject: "_:c.1", Predicate: "name", Lang: "en", ObjectValue: val("Alice"),
+				Facets: []*api.Facet{{
+					Key:     "source",
+					ValType: api.Facet_STRING,
+					Value:   []byte("passport"),
+				}}},
+			{Subject: "_:c.1", Predicate: "name", Lang: "zh-Hant-TW", ObjectValue: val("愛麗絲")},
+			{Subject: "_:c.1", Predicate: "nickname", Lang: "en", ObjectValue: val("Al")},
+			{Subject: "_:c.1", Predicate: "nickname", Lang: "en", ObjectValue: val("Ali"),
+				Facets: []*api.Facet{{
+					Key:     "since",
+					ValType: api.Facet_INT,
+					Value:   []byte{0xd6, 0x07, 0, 0, 0, 0, 0, 0},
+				}}},
 		},
 	}
 	c.Test(t, false)
+	for _, d := range []string{
+		`{"name@": "Alice"}`,
+		`{"name@e n": "Alice"}`,
+		`{"name@1en": "Alice"}`,
+		`{"name@en-": "Alice"}`,
+		`{"@en": "Alice"}`,
+		`{"name@en!|source": "passport"}`,
+	} {
+		(&Case{Json: []byte(d), ExpectErr: true}).Test(t, false)
+	}
+}
+
+func TestNull(t *testing.T) {
+	c := &Case{
+		Json: []byte(`{
+			"uid": "0x1",
+			"name": null,
+			"nickname": [null, "Al"],
+			"friend": {"uid": "0x2"}
+		}`),
+		Quads: []*api.NQuad{{
+			Subject:     "0x1",
+			Predicate:   "nickname",
+			ObjectValue: val("Al"),
+		}, {
+			Subject:   "0x1",
+			Predicate: "friend",
+			ObjectId:  "0x2",
+		}},
+	}
+	c.Test(t, false)
+}
+
+func TestDelete(t *testing.T) {
+	cases := []*Case{
+		{
+			Json: []byte(`{
+				"uid": "0x1",
+				"name": null,
+				"age": 26,
+				"friend": {"uid": "0x2"}
+			}`),
+			Quads: []*api.NQuad{{
+				Subject:     "0x1",
+				Predicate:   "name",
+				ObjectValue: val(nil),
+			}, {
+				Subject:     "0x1",
+				Predicate:   "age",
+				ObjectValue: val(int64(26)),
+			}, {
+				Subject:   "0x1",
+				Predicate: "friend",
+				ObjectId:  "0x2",
+			}},
+			Delete: true,
+		},
+		{
+			// uid-only objects delete the whole node, unless they're the
+			// object of an edge
+			Json: []byte(`[
+				{"uid": "0x1"},
+				{"uid": "0x2", "friend": [{"uid": "0x3"}]}
+			]`),
+			Quads: []*api.NQuad{{
+				Subject:     "0x1",
+				Predicate:   Star,
+				ObjectValue: val(nil),
+			}, {
+				Subject:   "0x2",
+				Predicate: "friend",
+				ObjectId:  "0x3",
+			}},
+			Delete: true,
+		},
+		{
+			Json:      []byte(`{"name": "Alice"}`),
+			ExpectErr: true,
+			Delete:    true,
+		},
+		{
+			Json:      []byte(`{"uid": "0x1", "friend": {"name": "Bob"}}`),
+			ExpectErr: true,
+			Delete:    true,
+		},
+	}
+	for _, c := range cases {
+		c.Test(t, false)
+	}
 }
 
 func Benchmark(b *testing.B) {
@@ -765,3 +1222,52 @@ func Benchmark(b *testing.B) {
 		NewParser().Run(d)
 	}
 }
+
+// facetArray returns an object with an n element array of scalars or objects,
+// with a map facet for every element.
+func facetArray(n int, objects bool) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"friend": [`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if objects {
+			fmt.Fprintf(buf, `{"name": "%d"}`, i)
+		} else {
+			fmt.Fprintf(buf, `"%d"`, i)
+		}
+	}
+	buf.WriteString(`], "friend|since": {`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, `"%d": %d`, i, i)
+	}
+	buf.WriteString(`}, "friend|close": true}`)
+	return buf.Bytes()
+}
+
+func BenchmarkFacetsMap(b *testing.B) {
+	for _, objects := range []bool{false, true} {
+		for _, n := range []int{10, 100, 1000} {
+			d := facetArray(n, objects)
+			name := fmt.Sprintf("scalars-%d", n)
+			if objects {
+				name = fmt.Sprintf("objects-%d", n)
+			}
+			b.Run(name, func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(d)))
+				p := NewParser()
+				for i := 0; i < b.N; i++ {
+					p.Reset()
+					if err := p.Run(d); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package chunker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/minio/simdjson-go"
+)
+
+// ErrorKind says what went wrong in a ParseError.
+type ErrorKind string
+
+const (
+	// ErrJSON is invalid JSON, the Parser never got to look at it
+	ErrJSON ErrorKind = "json"
+	// ErrUid is a "uid" that isn't a string
+	ErrUid ErrorKind = "uid"
+	// ErrKey is a key that can't be split into a predicate and a facet, like
+	// "a|b|c"
+	ErrKey ErrorKind = "key"
+	// ErrLang is a key with an invalid language tag
+	ErrLang ErrorKind = "lang"
+	// ErrFacetIndex is a map facet key that isn't an array index
+	ErrFacetIndex ErrorKind = "facet_index"
+	// ErrFacet is a facet value Dgraph can't store
+	ErrFacet ErrorKind = "facet"
+	// ErrFacetPredicate is a facet for a predicate that isn't in its object,
+	// it only shows up in Parser.Warnings
+	ErrFacetPredicate ErrorKind = "facet_predicate"
+	// ErrValue is a value Dgraph can't store, or a value without a predicate
+	// (at the top level)
+	ErrValue ErrorKind = "value"
+	// ErrGeo is a GeoJSON object that can't be decoded
+	ErrGeo ErrorKind = "geo"
+	// ErrDeleteUid is an object without a uid in Delete mode
+	ErrDeleteUid ErrorKind = "delete_uid"
+	// ErrSchema is a value that doesn't fit its predicate in Parser.Schema
+	ErrSchema ErrorKind = "schema"
+	// ErrXid is an error from the XidMap
+	ErrXid ErrorKind = "xid"
+	// ErrReverse is a value for a reverse predicate like "~friend", which can
+	// only point at objects
+	ErrReverse ErrorKind = "reverse"
+)
+
+// ParseError is returned by Run (and RunReader) when the JSON can't be turned
+// into quads. It points at the exact node that caused the problem.
+type ParseError struct {
+	Kind ErrorKind
+	// Index is the tape index of the node, -1 for ErrJSON
+	Index int
+	// Offset is the byte offset of the node from the start of its document,
+	// -1 if it isn't known
+	Offset int
+	// Path is the JSONPath of the node, like $.friend[2].name
+	Path string
+	// Record is the index of the top-level object the node is in, which is
+	// always 0 unless the document is an array, -1 for ErrJSON
+	Record int
+	// Document is the index of the document the node is in for RunReader
+	// (the line, for newline delimited JSON without blank lines), always 0
+	// for Run
+	Document int
+	// Predicate is the predicate being parsed, if there is one
+	Predicate string
+	Err       error
+}
+
+func newParseError(kind ErrorKind, predicate string, err error) *ParseError {
+	return &ParseError{Kind: kind, Index: -1, Offset: -1, Record: -1, Predicate: predicate, Err: err}
+}
+
+// jsonError wraps an error from simdjson or encoding/json, which only know
+// the offset (and only sometimes).
+func jsonError(err error) *ParseError {
+	e := newParseError(ErrJSON, "", err)
+	var syntax *json.SyntaxError
+	if errors.As(err, &syntax) {
+		e.Offset = int(syntax.Offset)
+	}
+	return e
+}
+
+func (e *ParseError) Error() string {
+	s := fmt.Sprintf("%s error", e.Kind)
+	if e.Path != "" {
+		s += " at " + e.Path
+	}
+	if e.Offset >= 0 {
+		s += fmt.Sprintf(" (offset %d)", e.Offset)
+	}
+	if e.Predicate != "" {
+		s += " for predicate " + e.Predicate
+	}
+	return s + ": " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// valueError is for a node that isn't an object where only objects (or arrays
+// of them) are allowed, like a number in the top-level array.
+func valueError(n byte) *ParseError {
+	return newParseError(ErrValue, "",
+		errors.New(fmt.Sprintf("expected an object, instead found: %c", n)))
+}
+
+func reverseError(pred string) *ParseError {
+	return newParseError(ErrReverse, pred,
+		errors.New(fmt.Sprintf("reverse predicate %s needs an object, not a value", pred)))
+}
+
+// locate is called by walk to fill in where the error happened, i is the tape
+// index of the node the ParserState was called with.
+func (p *Parser) locate(e *ParseError, i uint64) {
+	e.Index = int(i)
+	e.Offset = p.offsetOf(i)
+	e.Path = p.pathOf(i)
+	_, _, e.Record = p.recordOf(i)
+	e.Document = p.document
+}
+
+// recordOf finds the top-level object node i is in, it returns the tape index
+// of the object, the index just after it, and its index in the document.
+func (p *Parser) recordOf(i uint64) (uint64, uint64, int) {
+	tape := p.Parsed.Tape
+	// find the document, every opening root node points just past its closing
+	// root node, which is where the next document starts
+	root := uint64(0)
+	for next := tape[root] & simdjson.JSONVALUEMASK; next <= i; next = tape[root] & simdjson.JSONVALUEMASK {
+		root = next
+	}
+	start := root + 1
+	if byte(tape[start]>>56) != '[' {
+		return start, p.nextNode(start), 0
+	}
+	c := start + 1
+	for k := 0; ; k++ {
+		end := p.nextNode(c)
+		if end > i {
+			return c, end, k
+		}
+		c = end
+	}
+}
+
+// skipRecord is used by walk in Lenient mode. It saves e, drops every quad of
+// the top-level object e happened in (the object started when there were
+// mark quads and vars upsert vars) and moves both cursors to the end of it. It
+// returns the state to continue in.
+func (p *Parser) skipRecord(e *ParseError, mark, vars int) ParserState {
+	p.Errors = append(p.Errors, e)
+	p.Quads = p.Quads[:mark]
+	// the object's upsert vars would end up in the query without any quads
+	for _, v := range p.Vars[vars:] {
+		delete(p.vars, [2]string{v.Predicate, v.Value})
+	}
+	p.Vars = p.Vars[:vars]
+	p.Quad = p.newQuad()
+	p.Facet = p.newFacet()
+	start, end, _ := p.recordOf(uint64(e.Index))
+	for i := start; i < end; i++ {
+		switch byte(p.Parsed.Tape[i] >> 56) {
+		case '"':
+			p.StringCursor = p.Parsed.Tape[i]&simdjson.STRINGBUFMASK + p.Parsed.Tape[i+1]
+			i++
+		case 'l', 'u', 'd':
+			i++
+		}
+	}
+	// the closing node, walk moves past it
+	p.Cursor = end - 1
+	if start > 0 && byte(p.Parsed.Tape[start-1]>>56) != 'r' {
+		// the root array is all that's left
+		p.Levels.Levels = p.Levels.Levels[:1]
+		return p.states.array
+	}
+	p.Levels.Levels = p.Levels.Levels[:0]
+	return p.states.root
+}
+
+// pathFrame is an object or array on the way to the node pathOf is looking
+// for.
+type pathFrame struct {
+	object bool
+	// key is the current key of an object, waiting is true when the next
+	// string is a key rather than a value
+	key     string
+	waiting bool
+	// n is the current index of an array
+	n int
+}
+
+// pathOf walks the tape up to node i to find its JSONPath. It's only used for
+// errors so it doesn't need to be fast.
+func (p *Parser) pathOf(i uint64) string {
+	tape := p.Parsed.Tape
+	frames := make([]*pathFrame, 0)
+	for c := uint64(0); c <= i && c < uint64(len(tape)); {
+		n := byte(tape[c] >> 56)
+		switch n {
+		case 'r':
+			frames = frames[:0]
+			c++
+			continue
+		case '}', ']':
+			frames = frames[:len(frames)-1]
+			if c == i {
+				return path(frames)
+			}
+			c++
+			continue
+		}
+		if len(frames) > 0 {
+			f := frames[len(frames)-1]
+			switch {
+			case f.object && f.waiting:
+				f.key = p.stringAt(c)
+				f.waiting = false
+				if c == i {
+					return path(frames)
+				}
+				c += 2
+				continue
+			case f.object:
+				f.waiting = true
+			default:
+				f.n++
+			}
+		}
+		if c == i {
+			return path(frames)
+		}
+		switch n {
+		case '{', '[':
+			frames = append(frames, &pathFrame{object: n == '{', waiting: true, n: -1})
+			c++
+		case '"', 'l', 'u', 'd':
+			c += 2
+		default:
+			c++
+		}
+	}
+	return ""
+}
+
+func path(frames []*pathFrame) string {
+	s := "$"
+	for _, f := range frames {
+		switch {
+		case !f.object:
+			s += "[" + strconv.Itoa(f.n) + "]"
+		case isIdentifier(f.key):
+			s += "." + f.key
+		default:
+			s += "['" + strings.ReplaceAll(f.key, "'", `\'`) + "']"
+		}
+	}
+	return s
+}
+
+// isIdentifier reports whether key can be written as .key in a JSONPath,
+// otherwise it needs brackets (keys like "friend|close" or "name@en").
+func isIdentifier(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, c := range key {
+		letter := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// offsetOf finds the byte offset of node i from the start of its document by
+// tokenizing the original JSON alongside the tape (simdjson puts a whole
+// batch of documents in one tape). It returns -1 if the JSON isn't around.
+func (p *Parser) offsetOf(i uint64) int {
+	msg := p.Parsed.Message
+	// t is the tape index of the next token, start is the offset of the
+	// current document
+	t := uint64(0)
+	start := 0
+	depth := 0
+	for o := 0; o < len(msg); {
+		switch msg[o] {
+		case ' ', '\t', '\n', '\r', ',', ':':
+			o++
+			continue
+		}
+		if depth == 0 {
+			// opening root node
+			t++
+			start = o
+		}
+		if t >= i {
+			return o - start
+		}
+		switch c := msg[o]; c {
+		case '{', '[':
+			depth++
+			t++
+			o++
+		case '}', ']':
+			depth--
+			t++
+			o++
+		case '"':
+			for o++; o < len(msg) && msg[o] != '"'; o++ {
+				if msg[o] == '\\' {
+					o++
+				}
+			}
+			t += 2
+			o++
+		case 't', 'n':
+			t++
+			o += 4
+		case 'f':
+			t++
+			o += 5
+		default:
+			// numbers
+			for o++; o < len(msg) && strings.IndexByte("+-0123456789.eE", msg[o]) >= 0; o++ {
+			}
+			t += 2
+		}
+		if depth == 0 {
+			// closing root node
+			t++
+		}
+	}
+	return -1
+}
@@ -0,0 +1,276 @@
+package chunker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+func TestParseError(t *testing.T) {
+	cases := []struct {
+		json   string
+		delete bool
+		err    ParseError
+	}{
+		{
+			json: `{"name": "Alice", "friend": [{"name": "Bob"}, {"uid": 2}]}`,
+			err: ParseError{
+				Kind:      ErrUid,
+				Index:     18,
+				Offset:    54,
+				Path:      "$.friend[1].uid",
+				Predicate: "uid",
+			},
+		},
+		{
+			json: `[{"name": "Alice"}, {"friend": ["Bob"], "friend|since": {"first": 2006}}]`,
+			err: ParseError{
+				Kind:      ErrFacetIndex,
+				Index:     18,
+				Offset:    57,
+				Path:      "$[1]['friend|since'].first",
+				Predicate: "friend",
+			},
+		},
+		{
+			json: `{"uid": "0x1", "name@en-": "Alice"}`,
+			err: ParseError{
+				Kind:      ErrLang,
+				Index:     6,
+				Offset:    15,
+				Path:      "$['name@en-']",
+				Predicate: "name@en-",
+			},
+		},
+		{
+			json:   `{"uid": "0x1", "friend": {"name": "Bob"}}`,
+			delete: true,
+			err: ParseError{
+				Kind:      ErrDeleteUid,
+				Index:     13,
+				Offset:    39,
+				Path:      "$.friend",
+				Predicate: "friend",
+			},
+		},
+		{
+			json: `{"a|b|c": 5, "name": "x"}`,
+			err: ParseError{
+				Kind:      ErrKey,
+				Index:     2,
+				Offset:    1,
+				Path:      "$['a|b|c']",
+				Predicate: "a|b|c",
+			},
+		},
+		{
+			json: `[{"name": "a"}, 5]`,
+			err: ParseError{
+				Kind:   ErrValue,
+				Index:  8,
+				Offset: 16,
+				Path:   "$[1]",
+			},
+		},
+		{
+			json: `{"name": "Alice",}`,
+			err: ParseError{
+				Kind:   ErrJSON,
+				Index:  -1,
+				Offset: -1,
+			},
+		},
+	}
+	for _, c := range cases {
+		for _, fallback := range []bool{false, true} {
+			p := NewParser()
+			p.Fallback = fallback
+			p.Delete = c.delete
+			err := p.Run([]byte(c.json))
+			var e *ParseError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected a ParseError for %s but got: %v", c.json, err)
+			}
+			if e.Kind == ErrJSON && fallback {
+				// encoding/json knows where the syntax error is
+				e.Offset = -1
+			}
+			if e.Kind != c.err.Kind || e.Index != c.err.Index || e.Offset != c.err.Offset ||
+				e.Path != c.err.Path || e.Predicate != c.err.Predicate {
+				t.Fatalf("expected %+v but got %+v (fallback: %v)", c.err, *e, fallback)
+			}
+			if e.Err == nil || e.Error() == "" {
+				t.Fatal("expected the underlying error")
+			}
+		}
+	}
+}
+
+func TestLenient(t *testing.T) {
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		p.Lenient = true
+		if err := p.Run([]byte(`[
+			{"name": "Alice", "friend": [{"name": "Bob"}]},
+			{"name": "Charlie", "friend": ["Dave"], "friend|since": {"first": 2006}},
+			{"uid": 1},
+			{"name": "Erin", "pet": ["Rex"], "pet|since": {"0": 2006}}
+		]`)); err != nil {
+			t.Fatal(err)
+		}
+		checkQuads(t, p.Quads, []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "_:c.2",
+			Predicate:   "name",
+			ObjectValue: val("Bob"),
+		}, {
+			Subject:   "_:c.1",
+			Predicate: "friend",
+			ObjectId:  "_:c.2",
+		}, {
+			Subject:     "_:c.5",
+			Predicate:   "name",
+			ObjectValue: val("Erin"),
+		}, {
+			Subject:     "_:c.5",
+			Predicate:   "pet",
+			ObjectValue: val("Rex"),
+			Facets: []*api.Facet{{
+				Key:     "since",
+				ValType: api.Facet_INT,
+				Value:   []byte{0xd6, 0x07, 0, 0, 0, 0, 0, 0},
+			}},
+		}})
+		if len(p.Errors) != 2 {
+			t.Fatalf("expected 2 errors but got %d", len(p.Errors))
+		}
+		if p.Errors[0].Kind != ErrFacetIndex || p.Errors[0].Record != 1 {
+			t.Fatalf("unexpected error: %+v", *p.Errors[0])
+		}
+		if p.Errors[1].Kind != ErrUid || p.Errors[1].Record != 2 {
+			t.Fatalf("unexpected error: %+v", *p.Errors[1])
+		}
+	}
+}
+
+func TestRunReaderParseError(t *testing.T) {
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		err := p.RunReader(strings.NewReader(`{"name": "Alice"}
+{"name": "Bob"}
+{"uid": "0x3", "name@": "Charlie"}
+`), func([]*api.NQuad) error {
+			return nil
+		})
+		e, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("expected a ParseError but got %v (fallback: %v)", err, fallback)
+		}
+		// the offset is from the start of the third line
+		if e.Kind != ErrLang || e.Document != 2 || e.Record != 0 || e.Offset != 15 {
+			t.Fatalf("unexpected error: %+v (fallback: %v)", e, fallback)
+		}
+	}
+}
+
+func TestLenientRunReader(t *testing.T) {
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		p.Lenient = true
+		quads := make([]*api.NQuad, 0)
+		if err := p.RunReader(strings.NewReader(`{"uid": "0x1", "name": "Alice"}
+{"uid": "0x2", "name@": "Bob"}
+{"uid": "0x3", "name": "Charlie"}
+`), func(q []*api.NQuad) error {
+			quads = append(quads, q...)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		checkQuads(t, quads, []*api.NQuad{{
+			Subject:     "0x1",
+			Predicate:   "name",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "0x3",
+			Predicate:   "name",
+			ObjectValue: val("Charlie"),
+		}})
+		// the second line is the one that's skipped
+		if len(p.Errors) != 1 || p.Errors[0].Kind != ErrLang || p.Errors[0].Document != 1 {
+			t.Fatalf("unexpected errors: %v (fallback: %v)", p.Errors, fallback)
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		if err := p.Run([]byte(`[
+			{"uid": "0x1", "name": "Alice"},
+			{"uid": "0x2", "friend|close": true, "pet|since": {"0": 2006}}
+		]`)); err != nil {
+			t.Fatal(err)
+		}
+		checkQuads(t, p.Quads, []*api.NQuad{{
+			Subject:     "0x1",
+			Predicate:   "name",
+			ObjectValue: val("Alice"),
+		}})
+		if len(p.Warnings) != 2 {
+			t.Fatalf("expected 2 warnings but got %d", len(p.Warnings))
+		}
+		for i, path := range []string{"$[1]['friend|close']", "$[1]['pet|since']['0']"} {
+			w := p.Warnings[i]
+			if w.Kind != ErrFacetPredicate || w.Record != 1 || w.Path != path {
+				t.Fatalf("unexpected warning: %+v", *w)
+			}
+		}
+		p.Reset()
+		if len(p.Warnings) != 0 {
+			t.Fatal("expected Reset to clear the warnings")
+		}
+	}
+}
+
+func TestLenientBadNodes(t *testing.T) {
+	for _, d := range []string{
+		`{"a": 1, "a|f": [1]}`,
+		`{"a": 1, "a|f": null}`,
+		`{"a": 1, "a|f": {"0": null}}`,
+		`{"a": 1, "a|f": {"0": {"x": 1}}}`,
+		`{"a|b|c": 5}`,
+		`5`,
+		`[1, {"a": 1}]`,
+	} {
+		for _, fallback := range []bool{false, true} {
+			p := NewParser()
+			p.Fallback = fallback
+			p.Lenient = true
+			if err := p.Run([]byte(`[{"name": "a"}, ` + d + `, {"name": "z"}]`)); err != nil {
+				t.Fatal(err)
+			}
+			checkQuads(t, p.Quads, []*api.NQuad{{
+				Subject:     "_:c.1",
+				Predicate:   "name",
+				ObjectValue: val("a"),
+			}, {
+				Subject:     p.Quads[len(p.Quads)-1].Subject,
+				Predicate:   "name",
+				ObjectValue: val("z"),
+			}})
+			if len(p.Errors) == 0 {
+				t.Fatalf("expected an error for %s", d)
+			}
+		}
+	}
+}
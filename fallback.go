@@ -0,0 +1,160 @@
+package chunker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/minio/simdjson-go"
+)
+
+// useFallback reports whether the Parser has to use encoding/json instead of
+// simdjson, which needs AVX2 and CLMUL.
+func (p *Parser) useFallback() bool {
+	return p.Fallback || !simdjson.SupportedCPU()
+}
+
+// parseFallback is the encoding/json version of simdjson.Parse. It builds the
+// same tape simdjson would, so the rest of the Parser can't tell the
+// difference. Like simdjson.Parse, it reuses the buffers of reuse if it isn't
+// nil.
+func parseFallback(d []byte, reuse *simdjson.ParsedJson) (*simdjson.ParsedJson, error) {
+	dec := json.NewDecoder(bytes.NewReader(d))
+	dec.UseNumber()
+	pj := &simdjson.ParsedJson{}
+	if reuse != nil {
+		pj.Tape = reuse.Tape[:0]
+		pj.Strings = reuse.Strings[:0]
+	}
+	pj.Message = d
+	if err := appendTape(pj, dec); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("empty json document")
+		}
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid json: more than one document")
+	}
+	return pj, nil
+}
+
+// runReaderFallback is the encoding/json version of RunReader. Documents are
+// read one at a time, so only one document (and its tape) is ever in memory.
+// Each one is kept as it is until it's been parsed, errors need it for their
+// Offset.
+func (p *Parser) runReaderFallback(r io.Reader, fn func([]*api.NQuad) error) error {
+	dec := json.NewDecoder(r)
+	var raw json.RawMessage
+	for {
+		if err := dec.Decode(&raw); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		pj, err := parseFallback(raw, p.Parsed)
+		if err != nil {
+			return err
+		}
+		p.Parsed = pj
+		if err := p.walk(p.handOff(fn)); err != nil {
+			return err
+		}
+	}
+}
+
+// appendTape decodes the next document from dec and appends it to pj's tape
+// wrapped in root nodes, the way simdjson lays out every document:
+//
+//   - '{', '[' and the opening 'r' point one past their closing node
+//   - '}', ']' and the closing 'r' point back to their opening node
+//   - '"' points into pj.Strings and is followed by the string length
+//   - 'l', 'u' and 'd' are followed by the number
+//
+// It returns io.EOF if dec has no more documents.
+func appendTape(pj *simdjson.ParsedJson, dec *json.Decoder) error {
+	root := uint64(len(pj.Tape))
+	open := make([]uint64, 0)
+	for {
+		t, err := dec.Token()
+		if err != nil {
+			if err == io.EOF && (len(open) > 0 || uint64(len(pj.Tape)) > root) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if uint64(len(pj.Tape)) == root {
+			pj.Tape = append(pj.Tape, tapeNode('r', 0))
+		}
+		switch v := t.(type) {
+		case json.Delim:
+			switch v {
+			case '{', '[':
+				open = append(open, uint64(len(pj.Tape)))
+				pj.Tape = append(pj.Tape, tapeNode(byte(v), 0))
+			case '}', ']':
+				start := open[len(open)-1]
+				open = open[:len(open)-1]
+				pj.Tape = append(pj.Tape, tapeNode(byte(v), start))
+				pj.Tape[start] |= uint64(len(pj.Tape))
+			}
+		case string:
+			pj.Tape = append(pj.Tape,
+				tapeNode('"', simdjson.STRINGBUFBIT|uint64(len(pj.Strings))),
+				uint64(len(v)))
+			pj.Strings = append(pj.Strings, v...)
+		case json.Number:
+			if err = appendNumber(pj, v); err != nil {
+				return err
+			}
+		case bool:
+			if v {
+				pj.Tape = append(pj.Tape, tapeNode('t', 0))
+			} else {
+				pj.Tape = append(pj.Tape, tapeNode('f', 0))
+			}
+		case nil:
+			pj.Tape = append(pj.Tape, tapeNode('n', 0))
+		}
+		if len(open) == 0 {
+			break
+		}
+	}
+	pj.Tape[root] |= uint64(len(pj.Tape)) + 1
+	pj.Tape = append(pj.Tape, tapeNode('r', root))
+	return nil
+}
+
+// appendNumber puts integers on the tape as 'l' (or 'u' if they only fit in a
+// uint64) and everything else as 'd'.
+func appendNumber(pj *simdjson.ParsedJson, n json.Number) error {
+	s := n.String()
+	if strings.ContainsAny(s, ".eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		pj.Tape = append(pj.Tape, tapeNode('d', 0), math.Float64bits(f))
+		return nil
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		pj.Tape = append(pj.Tape, tapeNode('l', 0), uint64(i))
+		return nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		pj.Tape = append(pj.Tape, tapeNode('u', 0), u)
+		return nil
+	}
+	return fmt.Errorf("number out of range: %s", s)
+}
+
+func tapeNode(tag byte, payload uint64) uint64 {
+	return uint64(tag)<<56 | payload
+}
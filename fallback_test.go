@@ -0,0 +1,98 @@
+package chunker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/minio/simdjson-go"
+)
+
+func TestFallbackTape(t *testing.T) {
+	if !simdjson.SupportedCPU() {
+		t.Skip("simdjson isn't supported on this CPU")
+	}
+	d := []byte(`{
+		"name": "Alice \"Al\"",
+		"age": 26,
+		"weight": -58.7e1,
+		"married": true,
+		"divorced": false,
+		"kids": null,
+		"friend": [{"name": "Bob"}, {}],
+		"nickname": ["Al", "Ali"],
+		"address": {"type": "Point", "coordinates": [1.1, 2]}
+	}`)
+	expected, err := simdjson.Parse(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pj, err := parseFallback(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pj.Tape, expected.Tape) {
+		t.Fatalf("expected tape:\n%v\nbut got:\n%v\n", expected.Tape, pj.Tape)
+	}
+	if string(pj.Strings) != string(expected.Strings) {
+		t.Fatalf("expected strings %q but got %q\n", expected.Strings, pj.Strings)
+	}
+}
+
+func TestFallbackNumbers(t *testing.T) {
+	for _, d := range []string{
+		`{"key": 27670116110564327426}`,
+		`{"key": 1e400}`,
+	} {
+		if _, err := parseFallback([]byte(d), nil); err == nil {
+			t.Fatalf("expected an error for %s\n", d)
+		}
+	}
+	pj, err := parseFallback([]byte(`{"key": 18446744073709551615}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byte(pj.Tape[4]>>56) != 'u' || pj.Tape[5] != 18446744073709551615 {
+		t.Fatalf("expected a uint64 but got %c %d\n", pj.Tape[4]>>56, pj.Tape[5])
+	}
+}
+
+func TestFallbackErrors(t *testing.T) {
+	for _, d := range []string{
+		``,
+		`{"name": "Alice"`,
+		`{"name": "Alice"} {"name": "Bob"}`,
+		`{"name": }`,
+	} {
+		p := NewParser()
+		p.Fallback = true
+		if err := p.Run([]byte(d)); err == nil {
+			t.Fatalf("expected an error for %q\n", d)
+		}
+	}
+}
+
+func TestFallbackRunReader(t *testing.T) {
+	p := NewParser()
+	p.Fallback = true
+	docs := make([][]*api.NQuad, 0)
+	if err := p.RunReader(strings.NewReader(`{"name": "Alice"}
+{"name": "Bob", "friend": {"uid": "0x1"}}
+`), func(quads []*api.NQuad) error {
+		docs = append(docs, quads)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents but got %d\n", len(docs))
+	}
+	checkQuads(t, docs[0], []*api.NQuad{
+		{Subject: "_:c.1", Predicate: "name", ObjectValue: val("Alice")},
+	})
+	checkQuads(t, docs[1], []*api.NQuad{
+		{Subject: "_:c.2", Predicate: "name", ObjectValue: val("Bob")},
+		{Subject: "_:c.2", Predicate: "friend", ObjectId: "0x1"},
+	})
+}
@@ -0,0 +1,175 @@
+package chunker
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+
+	"github.com/dgraph-io/dgraph/types"
+	"github.com/minio/simdjson-go"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+)
+
+// isGeo reports whether the object starting at the Cursor is a GeoJSON
+// geometry. It only peeks at the tape, so neither cursor moves.
+func (p *Parser) isGeo() bool {
+	return p.geoAt(p.Cursor)
+}
+
+// geoAt reports whether the node at tape index i is a GeoJSON geometry: an
+// object with a geometry "type" and either "coordinates" or, for a
+// GeometryCollection, "geometries" holding more geometries. The keys can be in
+// any order.
+func (p *Parser) geoAt(i uint64) bool {
+	tape := p.Parsed.Tape
+	if byte(tape[i]>>56) != '{' {
+		return false
+	}
+	var typ string
+	var coordinates, geometries uint64
+	end := tape[i]&simdjson.JSONVALUEMASK - 1
+	for i++; i < end; i = p.nextNode(i + 2) {
+		switch p.stringAt(i) {
+		case "type":
+			if byte(tape[i+2]>>56) == '"' {
+				typ = p.stringAt(i + 2)
+			}
+		case "coordinates":
+			if byte(tape[i+2]>>56) == '[' {
+				coordinates = i + 2
+			}
+		case "geometries":
+			if byte(tape[i+2]>>56) == '[' {
+				geometries = i + 2
+			}
+		}
+	}
+	switch typ {
+	case "Point", "MultiPoint":
+	case "LineString", "MultiLineString":
+	case "Polygon", "MultiPolygon":
+	case "GeometryCollection":
+		if geometries == 0 {
+			return false
+		}
+		end = tape[geometries]&simdjson.JSONVALUEMASK - 1
+		for g := geometries + 1; g < end; g = p.nextNode(g) {
+			if !p.geoAt(g) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+	return coordinates != 0
+}
+
+// nextNode returns the tape index of the node after the one at i, skipping
+// over objects and arrays.
+func (p *Parser) nextNode(i uint64) uint64 {
+	switch byte(p.Parsed.Tape[i] >> 56) {
+	case '{', '[':
+		return p.Parsed.Tape[i] & simdjson.JSONVALUEMASK
+	case '"', 'l', 'u', 'd':
+		return i + 2
+	}
+	return i + 1
+}
+
+// stringAt returns the string at tape index i without touching the
+// StringCursor.
+func (p *Parser) stringAt(i uint64) string {
+	offset := p.Parsed.Tape[i] & simdjson.STRINGBUFMASK
+	return string(p.Parsed.Strings[offset : offset+p.Parsed.Tape[i+1]])
+}
+
+// getGeoValue is used by Value and Array (like getScalarValue) when isGeo finds
+// a geo object at the Cursor. It pushes p.Quad with the geo value and moves
+// both cursors to the end of the object.
+func (p *Parser) getGeoValue() error {
+	if isReverse(p.Quad.Predicate) {
+		return reverseError(p.Quad.Predicate)
+	}
+	object, strings := p.geoJSON(p.Cursor)
+	p.StringCursor += strings
+	// the closing node, walk moves past it
+	p.Cursor = p.Parsed.Tape[p.Cursor]&simdjson.JSONVALUEMASK - 1
+	var geoStruct geom.T
+	if err := geojson.Unmarshal(object, &geoStruct); err != nil {
+		return newParseError(ErrGeo, p.Quad.Predicate, err)
+	}
+	if pred := p.predicate(p.Quad.Predicate); pred != nil {
+		if err := p.typeValue(types.Val{Tid: types.GeoID, Value: geoStruct}, pred); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if p.Quad.ObjectValue, err = types.ObjectValue(types.GeoID, geoStruct); err != nil {
+			return newParseError(ErrGeo, p.Quad.Predicate, err)
+		}
+	}
+	p.appendQuad(p.Quad, p.Levels.Object(0))
+	p.Quad = p.newQuad()
+	return nil
+}
+
+// geoJSON turns the object starting at tape index i back into JSON, and also
+// returns the size of every string in it so the StringCursor can skip them.
+func (p *Parser) geoJSON(i uint64) ([]byte, uint64) {
+	tape := p.Parsed.Tape
+	buf := &bytes.Buffer{}
+	strings := uint64(0)
+	// objects holds whether each open node is an object (or an array), and
+	// counts holds how many values (including keys) have been written to it
+	objects := make([]bool, 0)
+	counts := make([]int, 0)
+	end := tape[i] & simdjson.JSONVALUEMASK
+	for ; i < end; i++ {
+		n := byte(tape[i] >> 56)
+		if n == '}' || n == ']' {
+			buf.WriteByte(n)
+			objects = objects[:len(objects)-1]
+			counts = counts[:len(counts)-1]
+			continue
+		}
+		if last := len(counts) - 1; last >= 0 {
+			if counts[last] > 0 {
+				if objects[last] && counts[last]%2 == 1 {
+					buf.WriteByte(':')
+				} else {
+					buf.WriteByte(',')
+				}
+			}
+			counts[last]++
+		}
+		switch n {
+		case '{', '[':
+			buf.WriteByte(n)
+			objects = append(objects, n == '{')
+			counts = append(counts, 0)
+		case '"':
+			s := p.stringAt(i)
+			writeJSONString(buf, s)
+			strings += uint64(len(s))
+			i++
+		case 'l':
+			buf.WriteString(strconv.FormatInt(int64(tape[i+1]), 10))
+			i++
+		case 'u':
+			buf.WriteString(strconv.FormatUint(tape[i+1], 10))
+			i++
+		case 'd':
+			buf.WriteString(strconv.FormatFloat(math.Float64frombits(tape[i+1]), 'g', -1, 64))
+			i++
+		case 't':
+			buf.WriteString("true")
+		case 'f':
+			buf.WriteString("false")
+		case 'n':
+			buf.WriteString("null")
+		}
+	}
+	return buf.Bytes(), strings
+}
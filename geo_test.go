@@ -0,0 +1,192 @@
+package chunker
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/dgraph-io/dgraph/types"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+)
+
+// geoVal is val for GeoJSON.
+func geoVal(t *testing.T, s string) *api.Value {
+	t.Helper()
+	var g geom.T
+	if err := geojson.Unmarshal([]byte(s), &g); err != nil {
+		t.Fatal(err)
+	}
+	v, err := types.ObjectValue(types.GeoID, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+var geoTypes = []string{
+	`{"type": "Point", "coordinates": [1.1, 2]}`,
+	`{"type": "MultiPoint", "coordinates": [[1, 2], [3, 4]]}`,
+	`{"type": "LineString", "coordinates": [[1, 2], [3, 4]]}`,
+	`{"type": "MultiLineString", "coordinates": [[[1, 2], [3, 4]], [[5, 6], [7, 8]]]}`,
+	`{"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}`,
+	`{"type": "MultiPolygon", "coordinates": [[[[0, 0], [1, 0], [1, 1], [0, 0]]]]}`,
+	`{"type": "GeometryCollection", "geometries": [
+		{"type": "Point", "coordinates": [1, 2]},
+		{"type": "LineString", "coordinates": [[1, 2], [3, 4]]}
+	]}`,
+}
+
+func TestGeo(t *testing.T) {
+	for _, g := range geoTypes {
+		c := &Case{
+			Json: []byte(`{
+				"uid": "0x1",
+				"address": ` + g + `,
+				"name": "Alice",
+				"address|verified": true
+			}`),
+			Quads: []*api.NQuad{{
+				Subject:     "0x1",
+				Predicate:   "address",
+				ObjectValue: geoVal(t, g),
+				Facets: []*api.Facet{{
+					Key:     "verified",
+					ValType: api.Facet_BOOL,
+					Value:   []byte{0x01},
+				}},
+			}, {
+				Subject:     "0x1",
+				Predicate:   "name",
+				ObjectValue: val("Alice"),
+			}},
+		}
+		c.Test(t, false)
+	}
+}
+
+func TestGeoArray(t *testing.T) {
+	c := &Case{
+		Json: []byte(`{
+			"uid": "0x1",
+			"location": [` + geoTypes[0] + `, ` + geoTypes[6] + `],
+			"location|current": {
+				"1": true
+			},
+			"home": ` + geoTypes[2] + `,
+			"friend": [{"uid": "0x2"}]
+		}`),
+		Quads: []*api.NQuad{{
+			Subject:     "0x1",
+			Predicate:   "location",
+			ObjectValue: geoVal(t, geoTypes[0]),
+		}, {
+			Subject:     "0x1",
+			Predicate:   "location",
+			ObjectValue: geoVal(t, geoTypes[6]),
+			Facets: []*api.Facet{{
+				Key:     "current",
+				ValType: api.Facet_BOOL,
+				Value:   []byte{0x01},
+			}},
+		}, {
+			Subject:     "0x1",
+			Predicate:   "home",
+			ObjectValue: geoVal(t, geoTypes[2]),
+		}, {
+			Subject:   "0x1",
+			Predicate: "friend",
+			ObjectId:  "0x2",
+		}},
+	}
+	c.Test(t, false)
+}
+
+func TestGeoKeyOrder(t *testing.T) {
+	nested := `{"geometries": [
+		{"coordinates": [1, 2], "type": "Point"},
+		{"type": "GeometryCollection", "geometries": [
+			{"coordinates": [[1, 2], [3, 4]], "type": "LineString"}
+		]}
+	], "type": "GeometryCollection"}`
+	c := &Case{
+		Json: []byte(`{
+			"uid": "0x1",
+			"home": {"coordinates": [1.1, 2], "type": "Point"},
+			"area": ` + nested + `
+		}`),
+		Quads: []*api.NQuad{{
+			Subject:     "0x1",
+			Predicate:   "home",
+			ObjectValue: geoVal(t, geoTypes[0]),
+		}, {
+			Subject:     "0x1",
+			Predicate:   "area",
+			ObjectValue: geoVal(t, nested),
+		}},
+	}
+	c.Test(t, false)
+}
+
+func TestGeoNotGeo(t *testing.T) {
+	// objects that look a bit like geo are still nodes, and the strings
+	// peeked at while checking them are still read in order afterwards
+	c := &Case{
+		Json: []byte(`{
+			"uid": "0x1",
+			"pet": {"uid": "0x2", "type": "Point", "name": "Rex"},
+			"car": {"uid": "0x3", "coordinates": [1, 2], "type": "Sedan"},
+			"area": {"uid": "0x4", "type": "GeometryCollection", "geometries": [{"name": "x"}]},
+			"name": "Alice"
+		}`),
+		Quads: []*api.NQuad{{
+			Subject:     "0x2",
+			Predicate:   "type",
+			ObjectValue: val("Point"),
+		}, {
+			Subject:     "0x2",
+			Predicate:   "name",
+			ObjectValue: val("Rex"),
+		}, {
+			Subject:   "0x1",
+			Predicate: "pet",
+			ObjectId:  "0x2",
+		}, {
+			Subject:     "0x3",
+			Predicate:   "coordinates",
+			ObjectValue: val(int64(1)),
+		}, {
+			Subject:     "0x3",
+			Predicate:   "coordinates",
+			ObjectValue: val(int64(2)),
+		}, {
+			Subject:     "0x3",
+			Predicate:   "type",
+			ObjectValue: val("Sedan"),
+		}, {
+			Subject:   "0x1",
+			Predicate: "car",
+			ObjectId:  "0x3",
+		}, {
+			Subject:     "0x4",
+			Predicate:   "type",
+			ObjectValue: val("GeometryCollection"),
+		}, {
+			Subject:     "_:c.5",
+			Predicate:   "name",
+			ObjectValue: val("x"),
+		}, {
+			Subject:   "0x4",
+			Predicate: "geometries",
+			ObjectId:  "_:c.5",
+		}, {
+			Subject:   "0x1",
+			Predicate: "area",
+			ObjectId:  "0x4",
+		}, {
+			Subject:     "0x1",
+			Predicate:   "name",
+			ObjectValue: val("Alice"),
+		}},
+	}
+	c.Test(t, false)
+}
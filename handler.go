@@ -0,0 +1,46 @@
+package chunker
+
+import (
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+// QuadHandler gets quads from a Parser as soon as they're complete, so the
+// Parser doesn't have to hold on to a whole document's quads.
+//
+// Facets can be defined anywhere in an object (even for the edge pointing at
+// it), so a quad is only known to be complete once the top-level object it's
+// in is done. HandleQuad is called for every quad of a top-level object,
+// in the order they'd have ended up in Parser.Quads, right after the object.
+// Returning an error stops the Parser, which returns the error as it is.
+// Like Parser.Quads, the quads are only valid until the Parser is Reset.
+type QuadHandler interface {
+	HandleQuad(*api.NQuad) error
+}
+
+// QuadHandlerFunc lets a plain func be used as a QuadHandler.
+type QuadHandlerFunc func(*api.NQuad) error
+
+func (f QuadHandlerFunc) HandleQuad(quad *api.NQuad) error {
+	return f(quad)
+}
+
+// flush hands every quad waiting in p.Quads to the Handler, if there is one.
+// The quads are then forgotten, so the Parser's memory use only depends on
+// the size of the biggest top-level object.
+func (p *Parser) flush() error {
+	if p.Handler == nil || len(p.Quads) == 0 {
+		return nil
+	}
+	for _, quad := range p.Quads {
+		if err := p.Handler.HandleQuad(quad); err != nil {
+			return err
+		}
+	}
+	for i := range p.Quads {
+		p.Quads[i] = nil
+	}
+	p.Quads = p.Quads[:0]
+	p.slab.release()
+	p.facets.release()
+	return nil
+}
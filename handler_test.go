@@ -0,0 +1,91 @@
+package chunker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+func TestQuadHandler(t *testing.T) {
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		quads := make([]*api.NQuad, 0)
+		// how many quads the Parser was holding on to each time
+		held := make([]int, 0)
+		p.Handler = QuadHandlerFunc(func(quad *api.NQuad) error {
+			quads = append(quads, quad)
+			held = append(held, len(p.Quads))
+			return nil
+		})
+		if err := p.Run([]byte(`[
+			{"name": "Alice", "friend": [{"name": "Bob"}], "friend|close": {"0": true}},
+			{"name": "Charlie", "age": 29, "age|since": 2006}
+		]`)); err != nil {
+			t.Fatal(err)
+		}
+		checkQuads(t, quads, []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "_:c.2",
+			Predicate:   "name",
+			ObjectValue: val("Bob"),
+		}, {
+			Subject:   "_:c.1",
+			Predicate: "friend",
+			ObjectId:  "_:c.2",
+			Facets: []*api.Facet{{
+				Key:     "close",
+				ValType: api.Facet_BOOL,
+				Value:   []byte{0x01},
+			}},
+		}, {
+			Subject:     "_:c.3",
+			Predicate:   "name",
+			ObjectValue: val("Charlie"),
+		}, {
+			Subject:     "_:c.3",
+			Predicate:   "age",
+			ObjectValue: val(int64(29)),
+			Facets: []*api.Facet{{
+				Key:     "since",
+				ValType: api.Facet_INT,
+				Value:   []byte{0xd6, 0x07, 0, 0, 0, 0, 0, 0},
+			}},
+		}})
+		// each object is handed off before the next one is parsed
+		for i, n := range []int{3, 3, 3, 2, 2} {
+			if held[i] != n {
+				t.Fatalf("expected the Parser to hold %d quads but it held %d", n, held[i])
+			}
+		}
+		if len(p.Quads) != 0 {
+			t.Fatalf("expected no quads left but there are %d", len(p.Quads))
+		}
+	}
+}
+
+func TestQuadHandlerError(t *testing.T) {
+	stop := errors.New("stop")
+	p := NewParser()
+	calls := 0
+	p.Handler = QuadHandlerFunc(func(*api.NQuad) error {
+		calls++
+		return stop
+	})
+	err := p.RunReader(strings.NewReader(`{"name": "Alice"}
+{"name": "Bob"}
+`), func([]*api.NQuad) error {
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("expected the handler's error but got: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected the Parser to stop after 1 call but it made %d", calls)
+	}
+}
@@ -0,0 +1,175 @@
+package chunker
+
+import (
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/dgraph-io/dgraph/types"
+)
+
+// SchemaInferer proposes a Schema for quads it's been shown, so a new data
+// source can be loaded without writing its schema by hand first. Add has the
+// signature RunReader and Pipeline.Run expect, so it can be handed to them
+// directly:
+//
+//	inferer := NewSchemaInferer()
+//	if err := p.RunReader(r, inferer.Add); err != nil {
+//		...
+//	}
+//	fmt.Print(inferer.Schema())
+//
+// It isn't safe for concurrent use.
+type SchemaInferer struct {
+	preds map[string]*inferredPredicate
+	// objects holds the first subject seen pointing at each object of an
+	// edge, for predicates that aren't @reverse yet
+	objects map[[2]string]string
+}
+
+// inferredPredicate is everything seen of a predicate so far.
+type inferredPredicate struct {
+	// seen has a bit set for every types.TypeID the predicate had a value of
+	seen uint32
+	// dates is how many strings looked like datetimes, strings how many
+	// strings there were in total
+	dates   int
+	strings int
+	list    bool
+	lang    bool
+	reverse bool
+}
+
+func NewSchemaInferer() *SchemaInferer {
+	return &SchemaInferer{
+		preds:   make(map[string]*inferredPredicate),
+		objects: make(map[[2]string]string),
+	}
+}
+
+// Add looks at the quads of one or more documents. A predicate is a list if a
+// subject has more than one value (or edge) for it in the same call to Add
+// (generated subjects are only unique within a document). An edge gets
+// @reverse once more than one subject points at the same object.
+func (s *SchemaInferer) Add(quads []*api.NQuad) error {
+	// values counts the values of each subject's predicates
+	values := make(map[[3]string]int)
+	for _, quad := range quads {
+		if quad.Predicate == Star {
+			continue
+		}
+		pred := s.preds[quad.Predicate]
+		if pred == nil {
+			pred = &inferredPredicate{}
+			s.preds[quad.Predicate] = pred
+		}
+		if quad.ObjectValue == nil {
+			pred.seen |= 1 << types.UidID
+			s.edge(pred, quad)
+		} else if !pred.value(quad.ObjectValue) {
+			// delete mode wildcards don't say anything about the type
+			continue
+		}
+		if quad.Lang != "" {
+			pred.lang = true
+		}
+		k := [3]string{quad.Subject, quad.Predicate, quad.Lang}
+		if values[k]++; values[k] > 1 {
+			pred.list = true
+		}
+	}
+	return nil
+}
+
+// edge checks if the object of an edge already had another subject pointing
+// at it.
+func (s *SchemaInferer) edge(pred *inferredPredicate, quad *api.NQuad) {
+	if pred.reverse {
+		return
+	}
+	k := [2]string{quad.Predicate, quad.ObjectId}
+	if subject, ok := s.objects[k]; !ok {
+		s.objects[k] = quad.Subject
+	} else if subject != quad.Subject {
+		pred.reverse = true
+	}
+}
+
+// value records the type of v, it returns false for values without one.
+func (pred *inferredPredicate) value(v *api.Value) bool {
+	var id types.TypeID
+	switch v := v.Val.(type) {
+	case *api.Value_StrVal:
+		id = types.StringID
+		pred.strings++
+		if looksLikeDate(v.StrVal) {
+			pred.dates++
+		}
+	case *api.Value_IntVal:
+		id = types.IntID
+	case *api.Value_DoubleVal:
+		id = types.FloatID
+	case *api.Value_BoolVal:
+		id = types.BoolID
+	case *api.Value_DatetimeVal:
+		id = types.DateTimeID
+	case *api.Value_GeoVal:
+		id = types.GeoID
+	case *api.Value_PasswordVal:
+		id = types.PasswordID
+	case *api.Value_BytesVal:
+		id = types.BinaryID
+	default:
+		return false
+	}
+	pred.seen |= 1 << id
+	return true
+}
+
+// looksLikeDate is stricter than types.ParseTime, which would take "2006" to
+// be a year.
+func looksLikeDate(s string) bool {
+	if len(s) < len("2006-01-02") || s[4] != '-' || s[7] != '-' {
+		return false
+	}
+	_, err := types.ParseTime(s)
+	return err == nil
+}
+
+// Schema returns the proposed Schema for every predicate seen so far.
+func (s *SchemaInferer) Schema() *Schema {
+	sch := &Schema{Predicates: make(map[string]*SchemaPredicate, len(s.preds))}
+	for name, pred := range s.preds {
+		typ := pred.typ()
+		sch.Predicates[name] = &SchemaPredicate{
+			Type:    typ,
+			List:    pred.list,
+			Lang:    pred.lang,
+			Reverse: pred.reverse && typ == types.UidID,
+		}
+	}
+	return sch
+}
+
+// typ picks the narrowest type that holds every value seen. Ints are widened
+// to floats, and strings are datetimes if every one of them looked like one.
+// Anything else that doesn't agree (or has a language) ends up a string.
+func (pred *inferredPredicate) typ() types.TypeID {
+	if pred.lang {
+		// @lang is only allowed on strings
+		return types.StringID
+	}
+	seen := pred.seen
+	if seen&(1<<types.StringID) != 0 && pred.dates == pred.strings {
+		seen = seen&^(1<<types.StringID) | 1<<types.DateTimeID
+	}
+	if seen == 1<<types.IntID|1<<types.FloatID {
+		return types.FloatID
+	}
+	for _, id := range []types.TypeID{
+		types.UidID, types.StringID, types.IntID, types.FloatID, types.BoolID,
+		types.DateTimeID, types.GeoID, types.PasswordID, types.BinaryID,
+	} {
+		if seen == 1<<id {
+			return id
+		}
+	}
+	return types.StringID
+}
@@ -0,0 +1,38 @@
+package chunker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaInferer(t *testing.T) {
+	inferer := NewSchemaInferer()
+	p := NewParser()
+	if err := p.RunReader(strings.NewReader(`{"name@en": "Alice", "age": 26, "score": 1, "works": {"uid": "0x9"}}
+{"name": "Bob", "age": 31, "score": 2.5, "works": {"uid": "0x9"}, "born": "1989-05-01"}
+{"tags": ["a", "b"], "friend": [{"name": "Charlie"}], "home": {"type": "Point", "coordinates": [1, 2]}}
+{"mixed": 1, "born": "2001-01-01T00:00:00Z", "id": "2006", "married": true}
+{"mixed": "one", "friend": [{"uid": "0x1"}, {"uid": "0x2"}]}
+`), inferer.Add); err != nil {
+		t.Fatal(err)
+	}
+	expected := `age: int .
+born: datetime .
+friend: [uid] .
+home: geo .
+id: string .
+married: bool .
+mixed: string .
+name: string @lang .
+score: float .
+tags: [string] .
+works: uid @reverse .
+`
+	if s := inferer.Schema().String(); s != expected {
+		t.Fatalf("expected schema:\n%s\nbut got:\n%s", expected, s)
+	}
+	// the proposed schema has to be one Dgraph accepts
+	if _, err := ParseSchema(expected); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,266 @@
+package chunker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+// Pipeline parses chunks (usually from a Chunker) on a pool of worker Parsers.
+//
+// All of the workers share Subjects, so generated subjects are unique across
+// chunks. Without Ordered, chunks are handed to fn as soon as they're parsed
+// and which chunk gets which subjects depends on scheduling. With Ordered,
+// chunks are handed to fn in input order and subjects are numbered as if the
+// chunks had been parsed one after another by a single Parser.
+type Pipeline struct {
+	Workers  int
+	Ordered  bool
+	Subjects *Subjects
+	Namer    SubjectNamer
+	// NewParser, if set, makes the Parser for each chunk, so the chunks can be
+	// parsed with options like Lenient, Schema, Types or Xids (with an XidMap
+	// shared by every Parser, to find the same entity in different chunks).
+	// The Pipeline still sets the Parser's Subjects and Namer, and its Handler
+	// is dropped: the quads go to fn. Keys aren't supported, every chunk would
+	// number its upsert vars on its own.
+	NewParser func() *Parser
+	// Errors holds every record the chunks' Parsers skipped in Lenient mode,
+	// and Warnings every warning, in the order the chunks were handed to fn.
+	// Both start over every Run.
+	Errors   []*ChunkError
+	Warnings []*ChunkError
+}
+
+// ChunkError is a ParseError from one of a Pipeline's chunks. Chunk is the
+// index of the chunk (in the order Run received them), the rest of the
+// ParseError is relative to the chunk.
+type ChunkError struct {
+	Chunk int
+	*ParseError
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d: %s", e.Chunk, e.ParseError.Error())
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.ParseError
+}
+
+func NewPipeline(workers int) *Pipeline {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &Pipeline{
+		Workers:  workers,
+		Subjects: &Subjects{},
+		Namer:    DefaultNamer,
+	}
+}
+
+// pipelineJob is a chunk waiting for a worker.
+type pipelineJob struct {
+	index int
+	data  []byte
+}
+
+// pipelineResult is a parsed chunk waiting to be handed to fn.
+type pipelineResult struct {
+	index int
+	quads []*api.NQuad
+	// names holds every subject the chunk generated, only used when the chunk
+	// was parsed with its own Subjects
+	names    *chunkNamer
+	errors   []*ParseError
+	warnings []*ParseError
+	err      error
+}
+
+// Run parses every chunk received from chunks and calls fn with the quads of
+// each one. fn is never called concurrently. If parsing a chunk or fn returns
+// an error, Run stops reading from chunks and returns the error (a ParseError
+// comes back as a ChunkError).
+func (p *Pipeline) Run(chunks <-chan []byte, fn func([]*api.NQuad) error) error {
+	p.Errors = nil
+	p.Warnings = nil
+	jobs := make(chan *pipelineJob)
+	results := make(chan *pipelineResult)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(jobs)
+		i := 0
+		for data := range chunks {
+			select {
+			case jobs <- &pipelineJob{index: i, data: data}:
+			case <-done:
+				return
+			}
+			i++
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < p.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				select {
+				case results <- p.parse(job):
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	if !p.Ordered {
+		for r := range results {
+			if r.err != nil {
+				return r.err
+			}
+			p.report(r)
+			if err := fn(r.quads); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// hold on to results that finished early until it's their turn
+	pending := make(map[int]*pipelineResult)
+	next := 0
+	for r := range results {
+		pending[r.index] = r
+		for r = pending[next]; r != nil; r = pending[next] {
+			delete(pending, next)
+			next++
+			if r.err != nil {
+				return r.err
+			}
+			r.names.rebase(r.quads, p.Subjects.reserve(uint64(len(r.names.names))))
+			p.report(r)
+			if err := fn(r.quads); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunChunker feeds every chunk from c through Run.
+func (p *Pipeline) RunChunker(c *Chunker, fn func([]*api.NQuad) error) error {
+	chunks := make(chan []byte)
+	errs := make(chan error, 1)
+	stop := make(chan struct{})
+	go func() {
+		defer close(chunks)
+		for {
+			chunk, err := c.Chunk()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case chunks <- chunk:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	err := p.Run(chunks, fn)
+	close(stop)
+	if err != nil {
+		return err
+	}
+	select {
+	case err = <-errs:
+	default:
+	}
+	return err
+}
+
+// report adds the errors and warnings of a chunk to p.Errors and p.Warnings.
+func (p *Pipeline) report(r *pipelineResult) {
+	for _, e := range r.errors {
+		p.Errors = append(p.Errors, &ChunkError{Chunk: r.index, ParseError: e})
+	}
+	for _, e := range r.warnings {
+		p.Warnings = append(p.Warnings, &ChunkError{Chunk: r.index, ParseError: e})
+	}
+}
+
+func (p *Pipeline) parse(job *pipelineJob) *pipelineResult {
+	var parser *Parser
+	if p.NewParser != nil {
+		parser = p.NewParser()
+		parser.Handler = nil
+	} else {
+		parser = NewParser()
+	}
+	r := &pipelineResult{index: job.index}
+	if len(parser.Keys) > 0 {
+		r.err = errors.New("a Pipeline can't parse upserts, every chunk would have its own vars")
+		return r
+	}
+	if p.Ordered {
+		r.names = &chunkNamer{namer: p.Namer, names: make(map[string]uint64)}
+		parser.Levels.Namer = r.names
+	} else {
+		parser.Levels.Subjects = p.Subjects
+		parser.Levels.Namer = p.Namer
+	}
+	if err := parser.Run(job.data); err != nil {
+		if e, ok := err.(*ParseError); ok {
+			err = &ChunkError{Chunk: job.index, ParseError: e}
+		}
+		r.err = err
+		return r
+	}
+	r.quads = parser.Quads
+	r.errors = parser.Errors
+	r.warnings = parser.Warnings
+	return r
+}
+
+// chunkNamer is used for chunks of an Ordered Pipeline, which are numbered from
+// 1 until it's their turn to be handed to fn. It remembers every name it hands
+// out so they can be renamed once the chunk's real offset is known.
+type chunkNamer struct {
+	namer SubjectNamer
+	names map[string]uint64
+}
+
+func (c *chunkNamer) Name(n uint64) string {
+	s := c.namer.Name(n)
+	c.names[s] = n
+	return s
+}
+
+// rebase renames the generated subjects in quads as if their numbering had
+// started at offset+1.
+func (c *chunkNamer) rebase(quads []*api.NQuad, offset uint64) {
+	if offset == 0 {
+		return
+	}
+	rename := func(s string) string {
+		if n, ok := c.names[s]; ok {
+			return c.namer.Name(n + offset)
+		}
+		return s
+	}
+	for _, quad := range quads {
+		quad.Subject = rename(quad.Subject)
+		quad.ObjectId = rename(quad.ObjectId)
+	}
+}
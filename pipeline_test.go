@@ -0,0 +1,154 @@
+package chunker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+const pipelineJson = `[
+	{"name": "A", "friend": [{"name": "A1"}, {"name": "A2"}]},
+	{"uid": "1000", "name": "B", "friend": {"name": "B1"}},
+	{"name": "C", "age": 30},
+	{"name": "D", "friend": {"name": "D1", "friend": {"name": "D11"}}}
+]`
+
+func TestPipelineOrdered(t *testing.T) {
+	// a single Parser over the whole input is the reference output
+	p := NewParser()
+	if err := p.Run([]byte(pipelineJson)); err != nil {
+		t.Fatal(err)
+	}
+	c := NewChunker(strings.NewReader(pipelineJson))
+	c.Objects = 1
+	pipeline := NewPipeline(4)
+	pipeline.Ordered = true
+	quads := make([]*api.NQuad, 0)
+	if err := pipeline.RunChunker(c, func(q []*api.NQuad) error {
+		quads = append(quads, q...)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkQuads(t, quads, p.Quads)
+}
+
+func TestPipelineUnordered(t *testing.T) {
+	c := NewChunker(strings.NewReader(pipelineJson))
+	c.Objects = 1
+	subjects := make(map[string]string)
+	if err := NewPipeline(4).RunChunker(c, func(quads []*api.NQuad) error {
+		// every generated subject must only ever show up with one name
+		for _, quad := range quads {
+			if quad.Predicate != "name" {
+				continue
+			}
+			name := quad.ObjectValue.GetStrVal()
+			if other, ok := subjects[quad.Subject]; ok && other != name {
+				t.Fatalf("subject %s used for both %s and %s\n",
+					quad.Subject, other, name)
+			}
+			subjects[quad.Subject] = name
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(subjects) != 9 {
+		t.Fatalf("expected 9 subjects but got %d\n", len(subjects))
+	}
+}
+
+func TestPipelineError(t *testing.T) {
+	chunks := make(chan []byte, 2)
+	chunks <- []byte(`[{"name": "A"}]`)
+	chunks <- []byte(`[{"uid": 1}]`)
+	close(chunks)
+	pipeline := NewPipeline(2)
+	pipeline.Ordered = true
+	err := pipeline.Run(chunks, func([]*api.NQuad) error {
+		return nil
+	})
+	var e *ChunkError
+	if !errors.As(err, &e) || e.Chunk != 1 || e.Kind != ErrUid {
+		t.Fatalf("expected a uid error for chunk 1 but got %v", err)
+	}
+}
+
+func TestPipelineLenient(t *testing.T) {
+	for _, ordered := range []bool{false, true} {
+		c := NewChunker(strings.NewReader(`[{"name": "a"}, {"a|b|c": 1}, {"name": "z"}]`))
+		c.Objects = 1
+		pipeline := NewPipeline(2)
+		pipeline.Ordered = ordered
+		pipeline.NewParser = func() *Parser {
+			p := NewParser()
+			p.Lenient = true
+			return p
+		}
+		quads := 0
+		if err := pipeline.RunChunker(c, func(q []*api.NQuad) error {
+			quads += len(q)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if quads != 2 {
+			t.Fatalf("expected 2 quads but got %d (ordered: %v)", quads, ordered)
+		}
+		if len(pipeline.Errors) != 1 || pipeline.Errors[0].Chunk != 1 || pipeline.Errors[0].Kind != ErrKey {
+			t.Fatalf("unexpected errors: %v (ordered: %v)", pipeline.Errors, ordered)
+		}
+	}
+}
+
+func TestPipelineKeys(t *testing.T) {
+	pipeline := NewPipeline(1)
+	pipeline.NewParser = func() *Parser {
+		p := NewParser()
+		p.Keys = []string{"email"}
+		return p
+	}
+	c := NewChunker(strings.NewReader(`[{"email": "a@example.com"}]`))
+	if err := pipeline.RunChunker(c, func([]*api.NQuad) error {
+		return nil
+	}); err == nil {
+		t.Fatal("expected an error for Keys")
+	}
+}
+
+func TestPipelineXids(t *testing.T) {
+	for _, ordered := range []bool{false, true} {
+		c := NewChunker(strings.NewReader(`[
+			{"id": "a", "friend": {"id": "b"}},
+			{"id": "b", "name": "B"},
+			{"name": "C", "friend": [{"id": "a"}, {"id": "b"}]}
+		]`))
+		c.Objects = 1
+		xids := NewMemoryXidMap()
+		pipeline := NewPipeline(3)
+		pipeline.Ordered = ordered
+		pipeline.NewParser = func() *Parser {
+			p := NewParser()
+			p.Xids = map[string]string{"": "id"}
+			p.XidMap = xids
+			return p
+		}
+		subjects := make(map[string]bool)
+		if err := pipeline.RunChunker(c, func(quads []*api.NQuad) error {
+			for _, quad := range quads {
+				subjects[quad.Subject] = true
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		// a and b are the same nodes in every chunk, C is the only generated
+		// subject
+		if len(subjects) != 3 || !subjects["_:xid.a"] || !subjects["_:xid.b"] {
+			t.Fatalf("unexpected subjects: %v", subjects)
+		}
+	}
+}
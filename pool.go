@@ -0,0 +1,156 @@
+package chunker
+
+import (
+	"sync"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+// Reset gets the Parser ready to Run another document as if it had just come
+// from NewParser, except it holds on to its buffers: the simdjson tape, the
+// quads, the facets and the Levels stack. Options (Fallback, Lenient, Delete,
+// Schema, Types, Xids, the XidMap, Keys and the Namer) are kept.
+//
+// The quads (and facets) from before the Reset are reused, so they can't be
+// used after it.
+//
+// Generated subjects start over at 1: the Parser gets a new Subjects, so one
+// that was sharing a Subjects with other Parsers (see Subjects) needs it set
+// again after the Reset, or its subjects will collide with theirs.
+func (p *Parser) Reset() {
+	p.Cursor = 1
+	p.StringCursor = 0
+	p.slab.reset()
+	p.facets.reset()
+	p.Quad = p.newQuad()
+	p.Facet = p.newFacet()
+	p.Quads = p.Quads[:0]
+	p.Levels.Levels = p.Levels.Levels[:0]
+	// the old Subjects might be shared, so it can't be reset, it's replaced
+	p.Levels.Subjects = &Subjects{}
+	p.FacetPred = ""
+	p.FacetLang = ""
+	p.FacetId = 0
+	p.Errors = p.Errors[:0]
+	p.document = 0
+	p.Warnings = p.Warnings[:0]
+	p.Vars = nil
+	p.vars = nil
+}
+
+var parserPool = sync.Pool{
+	New: func() interface{} {
+		return NewParser()
+	},
+}
+
+// GetParser is NewParser for high throughput, the Parser comes from a pool and
+// is likely to already have buffers big enough for the next document. Hand it
+// back with PutParser once its quads aren't needed anymore.
+func GetParser() *Parser {
+	return parserPool.Get().(*Parser)
+}
+
+// PutParser resets p, options included, and puts it back in the pool.
+func PutParser(p *Parser) {
+	p.Reset()
+	p.Fallback = false
+	p.Lenient = false
+	p.Handler = nil
+	p.Delete = false
+	p.Schema = nil
+	p.Types = nil
+	p.Xids = nil
+	p.XidMap = nil
+	p.Keys = nil
+	p.Levels.Namer = DefaultNamer
+	parserPool.Put(p)
+}
+
+// quadSlabSize is how many quads are allocated at a time.
+const quadSlabSize = 64
+
+// quadSlab hands out quads from blocks of quadSlabSize, so a document with a
+// few hundred quads only takes a few allocations. After a reset the blocks are
+// handed out again.
+type quadSlab struct {
+	blocks [][]api.NQuad
+	// n is the number of quads handed out since the last reset
+	n int
+}
+
+func (s *quadSlab) get() *api.NQuad {
+	b, i := s.n/quadSlabSize, s.n%quadSlabSize
+	if b == len(s.blocks) {
+		s.blocks = append(s.blocks, make([]api.NQuad, quadSlabSize))
+	}
+	s.n++
+	quad := &s.blocks[b][i]
+	// Facets slices aren't reused, they can end up shared between quads (an
+	// array's facets are shared by every edge in it)
+	*quad = api.NQuad{Facets: make([]*api.Facet, 0)}
+	return quad
+}
+
+func (s *quadSlab) reset() {
+	s.n = 0
+}
+
+// release forgets every full block, for when the quads in them have been
+// handed off and it's not up to the slab to keep them around anymore.
+func (s *quadSlab) release() {
+	full := s.n / quadSlabSize
+	if full == 0 {
+		return
+	}
+	n := copy(s.blocks, s.blocks[full:])
+	for i := n; i < len(s.blocks); i++ {
+		s.blocks[i] = nil
+	}
+	s.blocks = s.blocks[:n]
+	s.n -= full * quadSlabSize
+}
+
+// newQuad is NewQuad for the Parser, the quad comes from the Parser's slab.
+func (p *Parser) newQuad() *api.NQuad {
+	return p.slab.get()
+}
+
+// facetSlab is quadSlab for facets.
+type facetSlab struct {
+	blocks [][]api.Facet
+	n      int
+}
+
+func (s *facetSlab) get() *api.Facet {
+	b, i := s.n/quadSlabSize, s.n%quadSlabSize
+	if b == len(s.blocks) {
+		s.blocks = append(s.blocks, make([]api.Facet, quadSlabSize))
+	}
+	s.n++
+	facet := &s.blocks[b][i]
+	*facet = api.Facet{}
+	return facet
+}
+
+func (s *facetSlab) reset() {
+	s.n = 0
+}
+
+func (s *facetSlab) release() {
+	full := s.n / quadSlabSize
+	if full == 0 {
+		return
+	}
+	n := copy(s.blocks, s.blocks[full:])
+	for i := n; i < len(s.blocks); i++ {
+		s.blocks[i] = nil
+	}
+	s.blocks = s.blocks[:n]
+	s.n -= full * quadSlabSize
+}
+
+// newFacet is newQuad for facets.
+func (p *Parser) newFacet() *api.Facet {
+	return p.facets.get()
+}
@@ -0,0 +1,138 @@
+package chunker
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+func TestReset(t *testing.T) {
+	docs := [][]byte{
+		[]byte(`{"name": "Alice", "friend": [{"name": "Bob", "age": 26}], "friend|close": {"0": true}}`),
+		[]byte(`[{"name": "Charlie"}, {"uid": "0x1", "home": {"type": "Point", "coordinates": [1, 2]}}]`),
+		[]byte(`{"name": "Dave", "nickname": ["D", "Davey"]}`),
+	}
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		for i := 0; i < 3; i++ {
+			for _, d := range docs {
+				fresh := NewParser()
+				fresh.Fallback = fallback
+				if err := fresh.Run(d); err != nil {
+					t.Fatal(err)
+				}
+				p.Reset()
+				if err := p.Run(d); err != nil {
+					t.Fatal(err)
+				}
+				checkQuads(t, p.Quads, fresh.Quads)
+			}
+		}
+	}
+}
+
+func TestParserPool(t *testing.T) {
+	d := []byte(`{"name": "Alice", "friend": {"name": "Bob"}}`)
+	for i := 0; i < 10; i++ {
+		p := GetParser()
+		if err := p.Run(d); err != nil {
+			t.Fatal(err)
+		}
+		checkQuads(t, p.Quads, []*api.NQuad{{
+			Subject:     "_:c.1",
+			Predicate:   "name",
+			ObjectValue: val("Alice"),
+		}, {
+			Subject:     "_:c.2",
+			Predicate:   "name",
+			ObjectValue: val("Bob"),
+		}, {
+			Subject:   "_:c.1",
+			Predicate: "friend",
+			ObjectId:  "_:c.2",
+		}})
+		// options mustn't follow the Parser into the pool
+		p.Delete = true
+		p.Handler = QuadHandlerFunc(func(*api.NQuad) error { return nil })
+		PutParser(p)
+	}
+}
+
+func TestFacetSlab(t *testing.T) {
+	p := NewParser()
+	doc := []byte(`{"name": "Alice", "name|since": 2006, "name|first": true}`)
+	for i := 0; i < 2; i++ {
+		p.Reset()
+		if err := p.Run(doc); err != nil {
+			t.Fatal(err)
+		}
+		// the same two facets every time
+		facets := p.Quads[0].Facets
+		if len(facets) != 2 || facets[0] != &p.facets.blocks[0][0] || facets[1] != &p.facets.blocks[0][1] {
+			t.Fatalf("expected the facets to come from the facet slab (run %d)", i)
+		}
+	}
+}
+
+var benchmarkDoc = []byte(`[{
+	"name": "Alice",
+	"age": 26,
+	"married": true,
+	"now": "2020-12-29T17:39:34Z",
+	"friend": [{
+		"name": "Bob",
+		"age": 24
+	}, {
+		"name": "Charlie",
+		"age": 29,
+		"nickname": ["Chuck", "Chaz"]
+	}],
+	"friend|close": {
+		"0": true,
+		"1": false
+	}
+}, {
+	"uid": "0x1",
+	"name": "Dave",
+	"home": {
+		"type": "Point",
+		"coordinates": [1.1, 2]
+	}
+}]`)
+
+func BenchmarkNewParser(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkDoc)))
+	for n := 0; n < b.N; n++ {
+		if err := NewParser().Run(benchmarkDoc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReset(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkDoc)))
+	p := NewParser()
+	for n := 0; n < b.N; n++ {
+		p.Reset()
+		if err := p.Run(benchmarkDoc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParserPool(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkDoc)))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p := GetParser()
+			if err := p.Run(benchmarkDoc); err != nil {
+				b.Fatal(err)
+			}
+			PutParser(p)
+		}
+	})
+}
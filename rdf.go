@@ -0,0 +1,217 @@
+package chunker
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/dgraph-io/dgraph/types/facets"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"github.com/twpayne/go-geom/encoding/wkb"
+)
+
+// Encoder writes quads as RDF N-Quad lines, the same format `dgraph live`
+// loads:
+//
+//	_:c.1 <age> "26"^^<xs:int> (since=2006-01-02T15:04:05Z) .
+//
+// Generated subjects are written as blank nodes, uids (like 0x1 or 1000) are
+// written as <0x1>. A Star predicate or value (from a Parser in Delete mode)
+// is written as *.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes one line for each quad.
+func (e *Encoder) Encode(quads ...*api.NQuad) error {
+	for _, quad := range quads {
+		e.buf = e.buf[:0]
+		if err := e.quad(quad); err != nil {
+			return err
+		}
+		if _, err := e.w.Write(e.buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteRDF writes every quad the Parser produced to w.
+func (p *Parser) WriteRDF(w io.Writer) error {
+	return NewEncoder(w).Encode(p.Quads...)
+}
+
+func (e *Encoder) quad(quad *api.NQuad) error {
+	e.node(quad.Subject)
+	if quad.Predicate == Star {
+		e.buf = append(e.buf, " * "...)
+	} else {
+		e.buf = append(e.buf, " <"...)
+		e.buf = append(e.buf, quad.Predicate...)
+		e.buf = append(e.buf, "> "...)
+	}
+	switch {
+	case quad.ObjectId != "":
+		e.node(quad.ObjectId)
+	case quad.ObjectValue != nil:
+		if err := e.value(quad.ObjectValue); err != nil {
+			return err
+		}
+		if quad.Lang != "" {
+			e.buf = append(e.buf, '@')
+			e.buf = append(e.buf, quad.Lang...)
+		}
+	default:
+		return fmt.Errorf("quad for predicate %s has neither an object id nor a value",
+			quad.Predicate)
+	}
+	if len(quad.Facets) > 0 {
+		e.buf = append(e.buf, " ("...)
+		for i, facet := range quad.Facets {
+			if i > 0 {
+				e.buf = append(e.buf, ", "...)
+			}
+			if err := e.facet(facet); err != nil {
+				return err
+			}
+		}
+		e.buf = append(e.buf, ')')
+	}
+	e.buf = append(e.buf, " .\n"...)
+	return nil
+}
+
+// node writes a subject or object id. Anything that isn't a uid (or an upsert
+// variable like uid(v1)) is a blank node.
+func (e *Encoder) node(s string) {
+	switch {
+	case strings.HasPrefix(s, "_:"), strings.HasPrefix(s, "uid("):
+		e.buf = append(e.buf, s...)
+	case isUid(s):
+		e.buf = append(e.buf, '<')
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, '>')
+	default:
+		e.buf = append(e.buf, "_:"...)
+		e.buf = append(e.buf, s...)
+	}
+}
+
+func (e *Encoder) value(v *api.Value) error {
+	switch val := v.Val.(type) {
+	case *api.Value_DefaultVal:
+		if val.DefaultVal == Star {
+			e.buf = append(e.buf, '*')
+			return nil
+		}
+		e.literal(val.DefaultVal, "")
+	case *api.Value_StrVal:
+		e.literal(val.StrVal, "")
+	case *api.Value_IntVal:
+		e.literal(strconv.FormatInt(val.IntVal, 10), "xs:int")
+	case *api.Value_DoubleVal:
+		e.literal(strconv.FormatFloat(val.DoubleVal, 'g', -1, 64), "xs:float")
+	case *api.Value_BoolVal:
+		e.literal(strconv.FormatBool(val.BoolVal), "xs:boolean")
+	case *api.Value_PasswordVal:
+		e.literal(val.PasswordVal, "xs:password")
+	case *api.Value_DatetimeVal:
+		var t time.Time
+		if err := t.UnmarshalBinary(val.DatetimeVal); err != nil {
+			return err
+		}
+		e.literal(t.Format(time.RFC3339Nano), "xs:dateTime")
+	case *api.Value_GeoVal:
+		// geo values are stored as WKB
+		g, err := wkb.Unmarshal(val.GeoVal)
+		if err != nil {
+			return err
+		}
+		b, err := geojson.Marshal(g)
+		if err != nil {
+			return err
+		}
+		e.literal(string(b), "geo:geojson")
+	default:
+		return fmt.Errorf("value type not handled: %T", v.Val)
+	}
+	return nil
+}
+
+// literal writes a quoted (and escaped) literal followed by its type, if any.
+func (e *Encoder) literal(s, typ string) {
+	e.quote(s)
+	if typ != "" {
+		e.buf = append(e.buf, "^^<"...)
+		e.buf = append(e.buf, typ...)
+		e.buf = append(e.buf, '>')
+	}
+}
+
+func (e *Encoder) facet(f *api.Facet) error {
+	val, err := facets.ValFor(f)
+	if err != nil {
+		return err
+	}
+	e.buf = append(e.buf, f.Key...)
+	e.buf = append(e.buf, '=')
+	switch v := val.Value.(type) {
+	case string:
+		e.quote(v)
+	case int64:
+		e.buf = strconv.AppendInt(e.buf, v, 10)
+	case float64:
+		e.buf = strconv.AppendFloat(e.buf, v, 'g', -1, 64)
+	case bool:
+		e.buf = strconv.AppendBool(e.buf, v)
+	case time.Time:
+		e.buf = append(e.buf, v.Format(time.RFC3339Nano)...)
+	default:
+		return fmt.Errorf("facet type not handled: %T", v)
+	}
+	return nil
+}
+
+// quote writes s as an N-Quad string literal.
+func (e *Encoder) quote(s string) {
+	e.buf = append(e.buf, '"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			e.buf = append(e.buf, `\"`...)
+		case '\\':
+			e.buf = append(e.buf, `\\`...)
+		case '\n':
+			e.buf = append(e.buf, `\n`...)
+		case '\r':
+			e.buf = append(e.buf, `\r`...)
+		case '\t':
+			e.buf = append(e.buf, `\t`...)
+		default:
+			if r < 0x20 {
+				e.buf = append(e.buf, fmt.Sprintf(`\u%04X`, r)...)
+				continue
+			}
+			e.buf = append(e.buf, string(r)...)
+		}
+	}
+	e.buf = append(e.buf, '"')
+}
+
+// isUid reports whether s is a Dgraph uid, either hex (0x1) or decimal.
+func isUid(s string) bool {
+	if strings.HasPrefix(s, "0x") {
+		_, err := strconv.ParseUint(s[2:], 16, 64)
+		return err == nil
+	}
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil
+}
@@ -0,0 +1,74 @@
+package chunker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteRDF(t *testing.T) {
+	p := NewParser()
+	if err := p.Run([]byte(`{
+		"name": "Alice \"Al\"\n",
+		"age": 26,
+		"weight": 58.7,
+		"married": true,
+		"now": "2020-12-29T17:39:34Z",
+		"address": {
+			"type": "Point",
+			"coordinates": [1.1, 2]
+		},
+		"friend": [{
+			"uid": "0x1f"
+		}, {
+			"name": "Bob"
+		}],
+		"friend|close": {
+			"0": true,
+			"1": false
+		},
+		"age|since": "2006-01-02T15:04:05Z",
+		"age|source": "passport",
+		"age|score": 2.5
+	}`)); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := p.WriteRDF(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `_:c.1 <name> "Alice \"Al\"\n" .
+_:c.1 <age> "26"^^<xs:int> (since=2006-01-02T15:04:05Z, source="passport", score=2.5) .
+_:c.1 <weight> "58.7"^^<xs:float> .
+_:c.1 <married> "true"^^<xs:boolean> .
+_:c.1 <now> "2020-12-29T17:39:34Z"^^<xs:dateTime> .
+_:c.1 <address> "{\"type\":\"Point\",\"coordinates\":[1.1,2]}"^^<geo:geojson> .
+_:c.1 <friend> <0x1f> (close=true) .
+_:c.3 <name> "Bob" .
+_:c.1 <friend> _:c.3 (close=false) .
+`
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteRDFDelete(t *testing.T) {
+	p := NewParser()
+	p.Delete = true
+	if err := p.Run([]byte(`[
+		{"uid": "0x1", "name": null, "friend": {"uid": "0x2"}},
+		{"uid": "0x3"}
+	]`)); err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := p.WriteRDF(buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<0x1> <name> * .
+<0x1> <friend> <0x2> .
+<0x3> * * .
+`
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,285 @@
+package chunker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/dgraph-io/dgraph/types/facets"
+	"github.com/twpayne/go-geom/encoding/geojson"
+	"github.com/twpayne/go-geom/encoding/wkb"
+)
+
+// Reconstruct is the inverse of Parser.Run: it builds the JSON document that
+// produces quads when parsed. Every object gets a "uid" field, edges are
+// nested objects (an object that's already been written somewhere else only
+// gets its "uid"), predicates with more than one value become arrays, and
+// facets are written as "pred|key" scalar facets or, for arrays, map facets
+// keyed by index.
+//
+// Subjects that are never the object of an edge become the top-level objects.
+// If there's more than one of them the document is a top-level array.
+//
+// Delete quads come back as the JSON a Parser in Delete mode reads: an S P *
+// quad is written as "pred": null and an S * * quad leaves only the "uid".
+func Reconstruct(quads []*api.NQuad) ([]byte, error) {
+	r := &reconstructor{
+		nodes:   make(map[string]*reconstructNode),
+		objects: make(map[string]bool),
+		written: make(map[string]bool),
+	}
+	for _, quad := range quads {
+		r.add(quad)
+	}
+	roots := make([]string, 0)
+	for _, subject := range r.order {
+		if !r.objects[subject] {
+			roots = append(roots, subject)
+		}
+	}
+	buf := &bytes.Buffer{}
+	docs := 0
+	write := func(subject string) error {
+		if docs > 0 {
+			buf.WriteByte(',')
+		}
+		docs++
+		return r.node(buf, subject)
+	}
+	for _, subject := range roots {
+		if err := write(subject); err != nil {
+			return nil, err
+		}
+	}
+	// anything left over is only reachable through a cycle
+	for _, subject := range r.order {
+		if !r.written[subject] {
+			if err := write(subject); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if docs == 1 {
+		return buf.Bytes(), nil
+	}
+	return append(append([]byte{'['}, buf.Bytes()...), ']'), nil
+}
+
+// reconstructNode holds every quad for a single subject, grouped by predicate.
+type reconstructNode struct {
+	predicates []string
+	quads      map[string][]*api.NQuad
+}
+
+type reconstructor struct {
+	nodes map[string]*reconstructNode
+	// order is the order subjects were first seen in
+	order []string
+	// objects holds every subject that's the object of an edge
+	objects map[string]bool
+	written map[string]bool
+}
+
+func (r *reconstructor) add(quad *api.NQuad) {
+	n, ok := r.nodes[quad.Subject]
+	if !ok {
+		n = &reconstructNode{quads: make(map[string][]*api.NQuad)}
+		r.nodes[quad.Subject] = n
+		r.order = append(r.order, quad.Subject)
+	}
+	key := quad.Predicate
+	if quad.Lang != "" {
+		key += "@" + quad.Lang
+	}
+	if _, ok := n.quads[key]; !ok {
+		n.predicates = append(n.predicates, key)
+	}
+	n.quads[key] = append(n.quads[key], quad)
+	if quad.ObjectId != "" {
+		r.objects[quad.ObjectId] = true
+	}
+}
+
+func (r *reconstructor) node(buf *bytes.Buffer, subject string) error {
+	buf.WriteString(`{"uid":`)
+	writeJSONString(buf, subject)
+	n, ok := r.nodes[subject]
+	if !ok || r.written[subject] {
+		buf.WriteByte('}')
+		return nil
+	}
+	r.written[subject] = true
+	for _, key := range n.predicates {
+		if key == Star {
+			continue
+		}
+		quads := n.quads[key]
+		buf.WriteByte(',')
+		writeJSONString(buf, key)
+		buf.WriteByte(':')
+		if len(quads) > 1 {
+			buf.WriteByte('[')
+		}
+		for i, quad := range quads {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := r.object(buf, quad); err != nil {
+				return err
+			}
+		}
+		if len(quads) > 1 {
+			buf.WriteByte(']')
+		}
+		if err := writeFacets(buf, key, quads); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func (r *reconstructor) object(buf *bytes.Buffer, quad *api.NQuad) error {
+	if quad.ObjectId != "" {
+		return r.node(buf, quad.ObjectId)
+	}
+	if quad.ObjectValue == nil {
+		buf.WriteString("null")
+		return nil
+	}
+	switch v := quad.ObjectValue.Val.(type) {
+	case *api.Value_DefaultVal:
+		if v.DefaultVal == Star {
+			buf.WriteString("null")
+			return nil
+		}
+		writeJSONString(buf, v.DefaultVal)
+	case *api.Value_StrVal:
+		writeJSONString(buf, v.StrVal)
+	case *api.Value_PasswordVal:
+		writeJSONString(buf, v.PasswordVal)
+	case *api.Value_IntVal:
+		buf.WriteString(strconv.FormatInt(v.IntVal, 10))
+	case *api.Value_DoubleVal:
+		writeJSONFloat(buf, v.DoubleVal)
+	case *api.Value_BoolVal:
+		buf.WriteString(strconv.FormatBool(v.BoolVal))
+	case *api.Value_DatetimeVal:
+		var t time.Time
+		if err := t.UnmarshalBinary(v.DatetimeVal); err != nil {
+			return err
+		}
+		writeJSONString(buf, t.Format(time.RFC3339Nano))
+	case *api.Value_GeoVal:
+		g, err := wkb.Unmarshal(v.GeoVal)
+		if err != nil {
+			return err
+		}
+		b, err := geojson.Marshal(g)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	default:
+		return fmt.Errorf("value type not handled: %T", quad.ObjectValue.Val)
+	}
+	return nil
+}
+
+// writeFacets writes the facets of every quad for a predicate. A single quad
+// gets scalar facets, an array of quads gets map facets keyed by the index of
+// the quad in the array.
+func writeFacets(buf *bytes.Buffer, key string, quads []*api.NQuad) error {
+	// facet keys in the order they were first seen
+	keys := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, quad := range quads {
+		for _, f := range quad.Facets {
+			if !seen[f.Key] {
+				seen[f.Key] = true
+				keys = append(keys, f.Key)
+			}
+		}
+	}
+	for _, k := range keys {
+		buf.WriteByte(',')
+		writeJSONString(buf, key+"|"+k)
+		buf.WriteByte(':')
+		if len(quads) == 1 {
+			if err := writeFacet(buf, findFacet(quads[0], k)); err != nil {
+				return err
+			}
+			continue
+		}
+		buf.WriteByte('{')
+		entries := 0
+		for i, quad := range quads {
+			f := findFacet(quad, k)
+			if f == nil {
+				continue
+			}
+			if entries > 0 {
+				buf.WriteByte(',')
+			}
+			entries++
+			writeJSONString(buf, strconv.Itoa(i))
+			buf.WriteByte(':')
+			if err := writeFacet(buf, f); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	}
+	return nil
+}
+
+func findFacet(quad *api.NQuad, key string) *api.Facet {
+	for _, f := range quad.Facets {
+		if f.Key == key {
+			return f
+		}
+	}
+	return nil
+}
+
+func writeFacet(buf *bytes.Buffer, f *api.Facet) error {
+	val, err := facets.ValFor(f)
+	if err != nil {
+		return err
+	}
+	switch v := val.Value.(type) {
+	case string:
+		writeJSONString(buf, v)
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		writeJSONFloat(buf, v)
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case time.Time:
+		writeJSONString(buf, v.Format(time.RFC3339Nano))
+	default:
+		return fmt.Errorf("facet type not handled: %T", v)
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	// marshalling a string can't fail
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+// writeJSONFloat makes sure floats always look like floats, otherwise 2.0
+// would come back as an int when the JSON is parsed again.
+func writeJSONFloat(buf *bytes.Buffer, f float64) {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	buf.WriteString(s)
+}
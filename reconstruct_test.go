@@ -0,0 +1,91 @@
+package chunker
+
+import (
+	"testing"
+)
+
+func TestReconstruct(t *testing.T) {
+	p := NewParser()
+	if err := p.Run([]byte(`{
+		"name": "Alice",
+		"weight": 58.0,
+		"now": "2020-12-29T17:39:34Z",
+		"address": {
+			"type": "Point",
+			"coordinates": [1.1, 2]
+		},
+		"friend": [{
+			"uid": "0x1f"
+		}, {
+			"name": "Bob",
+			"nickname": ["Bobby", "Rob"],
+			"nickname|since": {
+				"1": 2006
+			}
+		}],
+		"car": "MA0123",
+		"car|first": true
+	}`)); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Reconstruct(p.Quads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"uid":"_:c.1","name":"Alice","weight":58.0,` +
+		`"now":"2020-12-29T17:39:34Z",` +
+		`"address":{"type":"Point","coordinates":[1.1,2]},` +
+		`"friend":[{"uid":"0x1f"},{"uid":"_:c.3","name":"Bob","nickname":["Bobby","Rob"],` +
+		`"nickname|since":{"1":2006}}],` +
+		`"car":"MA0123","car|first":true}`
+	if string(d) != expected {
+		t.Fatalf("expected:\n%s\nbut got:\n%s\n", expected, d)
+	}
+	// parsing the reconstructed document gives the same quads back
+	again := NewParser()
+	if err = again.Run(d); err != nil {
+		t.Fatal(err)
+	}
+	checkQuads(t, again.Quads, p.Quads)
+}
+
+func TestReconstructRoots(t *testing.T) {
+	p := NewParser()
+	if err := p.Run([]byte(`[
+		{"uid": "0x1", "name": "Alice", "friend": {"uid": "0x2"}},
+		{"uid": "0x2", "name": "Bob", "friend": {"uid": "0x1"}},
+		{"name": "Charlie"}
+	]`)); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Reconstruct(p.Quads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0x1 and 0x2 point at each other, so they're only reachable through a
+	// cycle and end up after the real root
+	expected := `[{"uid":"_:c.5","name":"Charlie"},` +
+		`{"uid":"0x1","name":"Alice","friend":{"uid":"0x2","name":"Bob","friend":{"uid":"0x1"}}}]`
+	if string(d) != expected {
+		t.Fatalf("expected:\n%s\nbut got:\n%s\n", expected, d)
+	}
+}
+
+func TestReconstructDelete(t *testing.T) {
+	p := NewParser()
+	p.Delete = true
+	if err := p.Run([]byte(`[
+		{"uid": "0x1", "name": null, "age": 26},
+		{"uid": "0x3"}
+	]`)); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Reconstruct(p.Quads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"uid":"0x1","name":null,"age":26},{"uid":"0x3"}]`
+	if string(d) != expected {
+		t.Fatalf("expected:\n%s\nbut got:\n%s\n", expected, d)
+	}
+}
@@ -0,0 +1,185 @@
+package chunker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/dgraph/protos/pb"
+	"github.com/dgraph-io/dgraph/schema"
+	"github.com/dgraph-io/dgraph/types"
+)
+
+// Schema is what the Parser needs to know about a Dgraph schema to type values
+// the way Dgraph would. Predicates that aren't in it are typed by their JSON
+// token like usual.
+type Schema struct {
+	Predicates map[string]*SchemaPredicate
+}
+
+// SchemaPredicate is a single predicate of a Schema.
+type SchemaPredicate struct {
+	Type types.TypeID
+	// List is true for [type] predicates
+	List bool
+	// Lang is true for predicates with @lang
+	Lang bool
+	// Reverse is true for predicates with @reverse
+	Reverse bool
+}
+
+// ParseSchema parses Dgraph schema text like:
+//
+//	name: string @index(exact) .
+//	age: int .
+//	friend: [uid] @reverse .
+//
+// Type definitions are allowed but ignored.
+func ParseSchema(s string) (*Schema, error) {
+	parsed, err := schema.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	sch := &Schema{Predicates: make(map[string]*SchemaPredicate)}
+	for _, update := range parsed.Preds {
+		sch.Predicates[update.Predicate] = &SchemaPredicate{
+			Type:    types.TypeID(update.ValueType),
+			List:    update.List,
+			Lang:    update.Lang,
+			Reverse: update.Directive == pb.SchemaUpdate_REVERSE,
+		}
+	}
+	return sch, nil
+}
+
+// String writes the Schema as Dgraph schema text, one predicate per line in
+// alphabetical order.
+func (s *Schema) String() string {
+	names := make([]string, 0, len(s.Predicates))
+	for name := range s.Predicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b := &strings.Builder{}
+	for _, name := range names {
+		b.WriteString(name + ": " + s.Predicates[name].String() + "\n")
+	}
+	return b.String()
+}
+
+// String writes the predicate's type and directives like "[uid] @reverse .".
+func (pred *SchemaPredicate) String() string {
+	s := pred.Type.Name()
+	if pred.List {
+		s = "[" + s + "]"
+	}
+	if pred.Lang {
+		s += " @lang"
+	}
+	if pred.Reverse {
+		s += " @reverse"
+	}
+	return s + " ."
+}
+
+// predicate returns the SchemaPredicate for pred, or nil if there isn't a
+// Schema or pred isn't in it.
+func (p *Parser) predicate(pred string) *SchemaPredicate {
+	if p.Schema == nil {
+		return nil
+	}
+	return p.Schema.Predicates[pred]
+}
+
+// getTypedValue is getScalarValue for predicates in the Schema.
+func (p *Parser) getTypedValue(n byte, pred *SchemaPredicate) error {
+	var v types.Val
+	switch n {
+	case '"':
+		v = types.Val{Tid: types.StringID, Value: p.String()}
+	case 'u':
+		// too big for an int64, see getScalarValue
+		p.Cursor++
+		v = types.Val{Tid: types.FloatID, Value: float64(p.Parsed.Tape[p.Cursor])}
+	case 'l':
+		p.Cursor++
+		v = types.Val{Tid: types.IntID, Value: int64(p.Parsed.Tape[p.Cursor])}
+	case 'd':
+		p.Cursor++
+		v = types.Val{Tid: types.FloatID, Value: math.Float64frombits(p.Parsed.Tape[p.Cursor])}
+	case 't', 'f':
+		v = types.Val{Tid: types.BoolID, Value: n == 't'}
+	}
+	if err := p.typeValue(v, pred); err != nil {
+		return err
+	}
+	p.appendQuad(p.Quad, p.Levels.Object(0))
+	p.Quad = p.newQuad()
+	return nil
+}
+
+// typeValue converts v to the predicate's type and sets it as the value of
+// p.Quad.
+func (p *Parser) typeValue(v types.Val, pred *SchemaPredicate) error {
+	name := p.Quad.Predicate
+	if pred.Type == types.UidID {
+		return newParseError(ErrSchema, name,
+			errors.New(fmt.Sprintf("expected a uid, instead found a %s value", v.Tid.Name())))
+	}
+	if err := p.checkList(name, pred); err != nil {
+		return err
+	}
+	v, err := convert(v, pred.Type)
+	if err != nil {
+		return newParseError(ErrSchema, name, err)
+	}
+	if p.Quad.ObjectValue, err = types.ObjectValue(pred.Type, v.Value); err != nil {
+		return newParseError(ErrSchema, name, err)
+	}
+	return nil
+}
+
+// checkEdge is called with the predicate of an object that isn't a geo value,
+// it fails if the Schema says the predicate holds values.
+func (p *Parser) checkEdge(name string) error {
+	pred := p.predicate(name)
+	if pred == nil || pred.Type == types.UidID || pred.Type == types.DefaultID {
+		return p.checkList(name, pred)
+	}
+	return newParseError(ErrSchema, name,
+		errors.New(fmt.Sprintf("expected a %s value, instead found an object", pred.Type.Name())))
+}
+
+// checkList fails if the current Level is an array and the Schema says the
+// predicate isn't a list.
+func (p *Parser) checkList(name string, pred *SchemaPredicate) error {
+	if pred == nil || pred.List {
+		return nil
+	}
+	if l := p.Levels.Get(0); l == nil || !l.Array {
+		return nil
+	}
+	return newParseError(ErrSchema, name, errors.New("expected a single value, predicate isn't a list"))
+}
+
+// convert converts v to the type to, using Dgraph's own conversions (which
+// only convert from the binary encoding of anything other than a string).
+func convert(v types.Val, to types.TypeID) (types.Val, error) {
+	if v.Tid == to {
+		return v, nil
+	}
+	if to == types.PasswordID {
+		// Dgraph hashes passwords itself, so they're sent as they are
+		if v.Tid != types.StringID {
+			return v, errors.New(fmt.Sprintf("cannot convert %s to type password", v.Tid.Name()))
+		}
+		return types.Val{Tid: types.PasswordID, Value: v.Value}, nil
+	}
+	b := types.ValueForType(types.BinaryID)
+	if err := types.Marshal(v, &b); err != nil {
+		return v, err
+	}
+	return types.Convert(types.Val{Tid: v.Tid, Value: b.Value}, to)
+}
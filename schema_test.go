@@ -0,0 +1,174 @@
+package chunker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/dgraph-io/dgraph/types"
+)
+
+const testSchema = `
+	name: string @index(exact) @lang .
+	age: int .
+	score: float .
+	married: bool .
+	since: datetime .
+	home: geo .
+	secret: password .
+	tags: [string] .
+	friend: [uid] @reverse .
+	boss: uid .
+
+	type Person {
+		name
+		age
+	}
+`
+
+func TestParseSchema(t *testing.T) {
+	s, err := ParseSchema(testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Predicates) != 10 {
+		t.Fatalf("expected 10 predicates but got %d", len(s.Predicates))
+	}
+	for name, expected := range map[string]SchemaPredicate{
+		"name":   {Type: types.StringID, Lang: true},
+		"age":    {Type: types.IntID},
+		"tags":   {Type: types.StringID, List: true},
+		"friend": {Type: types.UidID, List: true, Reverse: true},
+		"boss":   {Type: types.UidID},
+	} {
+		if *s.Predicates[name] != expected {
+			t.Fatalf("unexpected predicate %s: %+v", name, *s.Predicates[name])
+		}
+	}
+	if _, err := ParseSchema("name: strin ."); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// schemaCase runs d through a Parser with testSchema, with and without the
+// fallback.
+func schemaCase(t *testing.T, d string) ([]*api.NQuad, error) {
+	t.Helper()
+	s, err := ParseSchema(testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var quads []*api.NQuad
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		p.Schema = s
+		if err = p.Run([]byte(d)); err != nil {
+			continue
+		}
+		if quads != nil {
+			checkQuads(t, p.Quads, quads)
+		}
+		quads = p.Quads
+	}
+	return quads, err
+}
+
+func TestSchema(t *testing.T) {
+	since, err := time.Parse(time.RFC3339, "2006-01-02T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quads, err := schemaCase(t, `{
+		"uid": "0x1",
+		"name": "Alice",
+		"age": "26",
+		"score": 7,
+		"married": "true",
+		"since": "2006-01-02",
+		"home": "{'type': 'Point', 'coordinates': [1.1, 2]}",
+		"secret": "hunter2",
+		"tags": ["a", 5],
+		"other": "2006",
+		"friend": [{"uid": "0x2"}],
+		"boss": {"uid": "0x3"}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkQuads(t, quads, []*api.NQuad{{
+		Subject:     "0x1",
+		Predicate:   "name",
+		ObjectValue: val("Alice"),
+	}, {
+		Subject:     "0x1",
+		Predicate:   "age",
+		ObjectValue: val(int64(26)),
+	}, {
+		Subject:     "0x1",
+		Predicate:   "score",
+		ObjectValue: val(float64(7)),
+	}, {
+		Subject:     "0x1",
+		Predicate:   "married",
+		ObjectValue: val(true),
+	}, {
+		Subject:     "0x1",
+		Predicate:   "since",
+		ObjectValue: val(since),
+	}, {
+		Subject:     "0x1",
+		Predicate:   "home",
+		ObjectValue: geoVal(t, `{"type": "Point", "coordinates": [1.1, 2]}`),
+	}, {
+		Subject:     "0x1",
+		Predicate:   "secret",
+		ObjectValue: &api.Value{Val: &api.Value_PasswordVal{PasswordVal: "hunter2"}},
+	}, {
+		Subject:     "0x1",
+		Predicate:   "tags",
+		ObjectValue: val("a"),
+	}, {
+		Subject:     "0x1",
+		Predicate:   "tags",
+		ObjectValue: val("5"),
+	}, {
+		// not in the schema, so it's still typed by its token
+		Subject:     "0x1",
+		Predicate:   "other",
+		ObjectValue: val("2006"),
+	}, {
+		Subject:   "0x1",
+		Predicate: "friend",
+		ObjectId:  "0x2",
+	}, {
+		Subject:   "0x1",
+		Predicate: "boss",
+		ObjectId:  "0x3",
+	}})
+}
+
+func TestSchemaErrors(t *testing.T) {
+	for _, d := range []string{
+		`{"age": "old"}`,
+		`{"score": "high"}`,
+		`{"married": "maybe"}`,
+		`{"since": "yesterday"}`,
+		`{"secret": 1234}`,
+		`{"name": ["Alice", "Al"]}`,
+		`{"age": {"years": 26}}`,
+		`{"boss": "0x3"}`,
+		`{"boss": [{"uid": "0x3"}, {"uid": "0x4"}]}`,
+		`{"home": {"type": "Point", "coordinates": "here"}}`,
+	} {
+		_, err := schemaCase(t, d)
+		var e *ParseError
+		if !errors.As(err, &e) {
+			t.Fatalf("expected a ParseError for %s but got %v", d, err)
+		}
+		if e.Kind != ErrSchema && e.Kind != ErrGeo {
+			t.Fatalf("unexpected error for %s: %v", d, e)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package chunker
+
+import (
+	"errors"
+	"io"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+	"github.com/minio/simdjson-go"
+)
+
+// RunReader parses newline delimited JSON from r. The input is parsed in
+// batches by simdjson.ParseNDStream and fn is called with the quads of each
+// document as soon as the document is done, so memory use is bounded by the
+// batch size rather than the size of the input.
+//
+// Generated subjects keep counting up across documents, so they're unique for
+// the whole stream. p.Quads only ever holds the current document's quads.
+//
+// If RunReader returns an error before the end of r, it stops reading r, but
+// a Read that's already underway in the background still finishes.
+func (p *Parser) RunReader(r io.Reader, fn func([]*api.NQuad) error) error {
+	p.document = 0
+	if p.useFallback() {
+		return p.runReaderFallback(r, fn)
+	}
+	res := make(chan simdjson.Stream)
+	reuse := make(chan *simdjson.ParsedJson, 1)
+	stop := &stopReader{r: r, stop: make(chan struct{})}
+	simdjson.ParseNDStream(stop, res, reuse)
+	for s := range res {
+		if s.Error != nil {
+			if errors.Is(s.Error, io.EOF) {
+				return nil
+			}
+			return s.Error
+		}
+		p.Parsed = s.Value
+		if err := p.walk(p.handOff(fn)); err != nil {
+			// let ParseNDStream finish up in the background, it closes res
+			// once it's done (which is soon, it's out of input)
+			close(stop.stop)
+			go func() {
+				for range res {
+				}
+			}()
+			return err
+		}
+		// the tape has been fully consumed (quads never point into it), so
+		// ParseNDStream is free to reuse its buffers, and Run mustn't
+		p.Parsed = nil
+		select {
+		case reuse <- s.Value:
+		default:
+		}
+	}
+	return nil
+}
+
+// handOff returns the done func for RunReader's walks, it hands each
+// document's quads to fn. The quads are fn's from then on, so the slabs forget
+// them (like flush does) and only ever hold the current document's.
+func (p *Parser) handOff(fn func([]*api.NQuad) error) func() error {
+	return func() error {
+		quads := p.Quads
+		p.Quads = make([]*api.NQuad, 0)
+		err := fn(quads)
+		p.slab.release()
+		p.facets.release()
+		return err
+	}
+}
+
+// stopReader is r until stop is closed, then it's at EOF. ParseNDStream can't
+// be cancelled, so this keeps it from reading the rest of the input after
+// RunReader has given up on it.
+type stopReader struct {
+	r    io.Reader
+	stop chan struct{}
+}
+
+func (s *stopReader) Read(b []byte) (int, error) {
+	select {
+	case <-s.stop:
+		return 0, io.EOF
+	default:
+		return s.r.Read(b)
+	}
+}
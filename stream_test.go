@@ -0,0 +1,87 @@
+package chunker
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+func TestRunReader(t *testing.T) {
+	r := strings.NewReader(`{"name": "Alice", "friend": {"name": "Bob"}}
+{"uid": "1000", "name": "Charlie"}
+{"name": "David", "age": 30}
+`)
+	expected := [][]*api.NQuad{{
+		{Subject: "_:c.1", Predicate: "name", ObjectValue: val("Alice")},
+		{Subject: "_:c.2", Predicate: "name", ObjectValue: val("Bob")},
+		{Subject: "_:c.1", Predicate: "friend", ObjectId: "_:c.2"},
+	}, {
+		{Subject: "1000", Predicate: "name", ObjectValue: val("Charlie")},
+	}, {
+		{Subject: "_:c.4", Predicate: "name", ObjectValue: val("David")},
+		{Subject: "_:c.4", Predicate: "age", ObjectValue: val(int64(30))},
+	}}
+	docs := 0
+	if err := NewParser().RunReader(r, func(quads []*api.NQuad) error {
+		if docs >= len(expected) {
+			t.Fatalf("expected %d documents but got more\n", len(expected))
+		}
+		checkQuads(t, quads, expected[docs])
+		docs++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if docs != len(expected) {
+		t.Fatalf("expected %d documents but got %d\n", len(expected), docs)
+	}
+}
+
+func TestRunReaderError(t *testing.T) {
+	stop := errors.New("stop")
+	r := strings.NewReader("{\"name\": \"Alice\"}\n{\"name\": \"Bob\"}\n")
+	if err := NewParser().RunReader(r, func([]*api.NQuad) error {
+		return stop
+	}); err != stop {
+		t.Fatalf("expected the handler error but got %v\n", err)
+	}
+}
+
+func TestStopReader(t *testing.T) {
+	r := &stopReader{r: strings.NewReader(`{"name": "Alice"}` + "\n"), stop: make(chan struct{})}
+	b := make([]byte, 4)
+	if n, err := r.Read(b); n != 4 || err != nil {
+		t.Fatalf("expected to read 4 bytes but got %d, %v\n", n, err)
+	}
+	// what RunReader does when it returns an error
+	close(r.stop)
+	if n, err := r.Read(b); n != 0 || err != io.EOF {
+		t.Fatalf("expected EOF once stopped but got %d, %v\n", n, err)
+	}
+}
+
+func TestRunReaderSlab(t *testing.T) {
+	docs := strings.Repeat(`{"name": "Alice", "name|source": "passport"}`+"\n", 5000)
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		n := 0
+		if err := p.RunReader(strings.NewReader(docs), func(quads []*api.NQuad) error {
+			n += len(quads)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if n != 5000 {
+			t.Fatalf("expected 5000 quads but got %d (fallback: %v)\n", n, fallback)
+		}
+		// the slabs only ever hold the current document's quads and facets
+		if len(p.slab.blocks) > 1 || len(p.facets.blocks) > 1 {
+			t.Fatalf("expected at most 1 block but got %d quad and %d facet blocks (fallback: %v)\n",
+				len(p.slab.blocks), len(p.facets.blocks), fallback)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package chunker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+)
+
+// Subjects hands out the numbers used for generated subjects. It's safe for
+// concurrent use, so one Subjects can be shared by Parsers working on different
+// chunks of the same input to keep their subjects from colliding.
+type Subjects struct {
+	n uint64
+}
+
+// Next returns the next unused subject number.
+func (s *Subjects) Next() uint64 {
+	return atomic.AddUint64(&s.n, 1)
+}
+
+// Count returns how many subject numbers have been handed out.
+func (s *Subjects) Count() uint64 {
+	return atomic.LoadUint64(&s.n)
+}
+
+// reserve hands out n subject numbers at once and returns the number just
+// before the first of them.
+func (s *Subjects) reserve(n uint64) uint64 {
+	return atomic.AddUint64(&s.n, n) - n
+}
+
+// SubjectNamer turns a generated subject number into the subject used in the
+// quads.
+type SubjectNamer interface {
+	Name(n uint64) string
+}
+
+// DefaultNamer names generated subjects _:c.1, _:c.2, ...
+var DefaultNamer SubjectNamer = BlankNamer{Prefix: "c"}
+
+// BlankNamer names generated subjects as Dgraph blank nodes: _:<Prefix>.<n>.
+type BlankNamer struct {
+	Prefix string
+}
+
+func (b BlankNamer) Name(n uint64) string {
+	return fmt.Sprintf("_:%s.%d", b.Prefix, n)
+}
+
+// NewSaltedNamer returns a BlankNamer with a random prefix (like _:c.9f86d081.1)
+// so separately loaded batches never share blank node names. Blank nodes are
+// only scoped to a single mutation in Dgraph, but with `dgraph live --xidmap`
+// they're remembered across loads.
+func NewSaltedNamer() (BlankNamer, error) {
+	salt := make([]byte, 4)
+	if _, err := rand.Read(salt); err != nil {
+		return BlankNamer{}, err
+	}
+	return BlankNamer{Prefix: "c." + hex.EncodeToString(salt)}, nil
+}
@@ -0,0 +1,44 @@
+package chunker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+type upperNamer struct{}
+
+func (upperNamer) Name(n uint64) string {
+	return strings.Repeat("A", int(n))
+}
+
+func TestSubjectNamer(t *testing.T) {
+	p := NewParser()
+	p.Levels.Namer = upperNamer{}
+	if err := p.Run([]byte(`{"name": "Alice", "friend": {"name": "Bob"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	checkQuads(t, p.Quads, []*api.NQuad{
+		{Subject: "A", Predicate: "name", ObjectValue: val("Alice")},
+		{Subject: "AA", Predicate: "name", ObjectValue: val("Bob")},
+		{Subject: "A", Predicate: "friend", ObjectId: "AA"},
+	})
+}
+
+func TestSaltedNamer(t *testing.T) {
+	a, err := NewSaltedNamer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewSaltedNamer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name(1) == b.Name(1) {
+		t.Fatalf("expected different names but both are %s\n", a.Name(1))
+	}
+	if !strings.HasPrefix(a.Name(1), "_:c.") || !strings.HasSuffix(a.Name(1), ".1") {
+		t.Fatalf("expected a blank node name but got %s\n", a.Name(1))
+	}
+}
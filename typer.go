@@ -0,0 +1,110 @@
+package chunker
+
+import (
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+// TypePredicate is the predicate Dgraph keeps the types of a node in.
+const TypePredicate = "dgraph.type"
+
+// TypedObject is what a TypeRule gets to pick the type of an object.
+type TypedObject struct {
+	Subject string
+	// Predicate is the predicate of the edge pointing at the object, it's
+	// empty for top-level objects
+	Predicate string
+	// Quads are the object's own quads (not those of nested objects)
+	Quads []*api.NQuad
+}
+
+// Value returns the string value of the object's predicate pred, or "" if it
+// doesn't have one.
+func (o *TypedObject) Value(pred string) string {
+	for _, quad := range o.Quads {
+		if quad.Predicate == pred && quad.Lang == "" {
+			if s, ok := quad.ObjectValue.GetVal().(*api.Value_StrVal); ok {
+				return s.StrVal
+			}
+		}
+	}
+	return ""
+}
+
+// TypeRule picks the dgraph.type of an object, or returns "" to leave it
+// untyped. It's set on Parser.Types.
+type TypeRule interface {
+	Type(o *TypedObject) string
+}
+
+// TypeRuleFunc lets a plain func be used as a TypeRule.
+type TypeRuleFunc func(*TypedObject) string
+
+func (f TypeRuleFunc) Type(o *TypedObject) string {
+	return f(o)
+}
+
+// TypeField types objects by a discriminator field like "type" or
+// "__typename", the first of the fields the object has a string value for
+// wins.
+type TypeField []string
+
+func (t TypeField) Type(o *TypedObject) string {
+	for _, field := range t {
+		if s := o.Value(field); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// TypePredicates types objects by the predicate pointing at them, like
+// TypePredicates{"friend": "Person"}.
+type TypePredicates map[string]string
+
+func (t TypePredicates) Type(o *TypedObject) string {
+	return t[o.Predicate]
+}
+
+// TypeRules tries each rule in order until one of them picks a type.
+type TypeRules []TypeRule
+
+func (t TypeRules) Type(o *TypedObject) string {
+	for _, rule := range t {
+		if s := rule.Type(o); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// typeObject is called by Object at the end of each object with a generated
+// subject when there's a TypeRule. It adds a dgraph.type quad for the object,
+// unless it already has one.
+func (p *Parser) typeObject(l *ParserLevel) {
+	o := &TypedObject{Subject: l.Subject}
+	if l.Wait != nil {
+		o.Predicate = l.Wait.Predicate
+	} else if p.Levels.InArray() {
+		if w := p.Levels.Get(1).Wait; w != nil {
+			o.Predicate = w.Predicate
+		}
+	}
+	for _, quad := range p.Quads[l.Start:] {
+		if quad.Subject != l.Subject {
+			continue
+		}
+		if quad.Predicate == TypePredicate {
+			return
+		}
+		o.Quads = append(o.Quads, quad)
+	}
+	typ := p.Types.Type(o)
+	if typ == "" {
+		return
+	}
+	quad := p.newQuad()
+	quad.Subject = l.Subject
+	quad.Predicate = TypePredicate
+	quad.ObjectValue = &api.Value{Val: &api.Value_StrVal{StrVal: typ}}
+	p.appendQuad(quad, l)
+}
@@ -0,0 +1,79 @@
+package chunker
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+func TestTypes(t *testing.T) {
+	for _, fallback := range []bool{false, true} {
+		p := NewParser()
+		p.Fallback = fallback
+		p.Types = TypeRules{
+			TypeField{"__typename", "type"},
+			TypePredicates{"friend": "Person"},
+			TypeRuleFunc(func(o *TypedObject) string {
+				if o.Predicate == "" {
+					return "Root"
+				}
+				return ""
+			}),
+		}
+		if err := p.Run([]byte(`{
+			"name": "Alice",
+			"friend": [{"name": "Bob"}, {"name": "Charlie", "__typename": "Robot"}],
+			"pet": {"name": "Rex"},
+			"boss": {"uid": "0x1", "name": "Dave"},
+			"home": {"type": "Point", "coordinates": [1, 2]},
+			"company": {"type": "Company", "dgraph.type": "Business"}
+		}`)); err != nil {
+			t.Fatal(err)
+		}
+		types := make(map[string]string)
+		for _, quad := range p.Quads {
+			if quad.Predicate == TypePredicate {
+				if _, ok := types[quad.Subject]; ok {
+					t.Fatalf("%s has more than one type", quad.Subject)
+				}
+				types[quad.Subject] = quad.ObjectValue.GetStrVal()
+			}
+		}
+		for subject, typ := range map[string]string{
+			"_:c.1": "Root",
+			"_:c.2": "Person",
+			"_:c.3": "Robot",
+			"_:c.6": "Business",
+		} {
+			if types[subject] != typ {
+				t.Fatalf("expected %s to be a %s but got %q", subject, typ, types[subject])
+			}
+		}
+		// the pet doesn't match any rule, and the boss has a uid
+		if len(types) != 4 {
+			t.Fatalf("expected 4 types but got %v", types)
+		}
+	}
+}
+
+func TestTypesOrder(t *testing.T) {
+	p := NewParser()
+	p.Types = TypePredicates{"friend": "Person"}
+	if err := p.Run([]byte(`{"uid": "0x1", "friend": {"name": "Bob"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	// the type comes right after the object's own quads, before the edge
+	checkQuads(t, p.Quads, []*api.NQuad{{
+		Subject:     "_:c.2",
+		Predicate:   "name",
+		ObjectValue: val("Bob"),
+	}, {
+		Subject:     "_:c.2",
+		Predicate:   TypePredicate,
+		ObjectValue: val("Person"),
+	}, {
+		Subject:   "0x1",
+		Predicate: "friend",
+		ObjectId:  "_:c.2",
+	}})
+}
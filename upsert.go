@@ -0,0 +1,137 @@
+package chunker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+// UpsertVar is a query variable of an upsert, it finds the node with Value
+// for Predicate.
+type UpsertVar struct {
+	Name      string
+	Predicate string
+	// Value is already written the way the query needs it, strings are quoted
+	Value string
+}
+
+// Upsert parses d into a Dgraph upsert request. Objects without a uid are
+// looked up by the first of keys they have a value for, so the mutation
+// updates existing nodes rather than creating new ones every time:
+//
+//	{"email": "alice@example.com", "name": "Alice"}
+//
+// becomes:
+//
+//	{
+//		v1 as var(func: eq(email, "alice@example.com"))
+//	}
+//
+//	uid(v1) <email> "alice@example.com" .
+//	uid(v1) <name> "Alice" .
+func Upsert(d []byte, keys ...string) (*api.Request, error) {
+	p := NewParser()
+	p.Keys = keys
+	if err := p.Run(d); err != nil {
+		return nil, err
+	}
+	return p.UpsertRequest(), nil
+}
+
+// UpsertRequest returns the Parser's quads as an upsert request, with a query
+// block for every variable in p.Vars.
+func (p *Parser) UpsertRequest() *api.Request {
+	req := &api.Request{
+		Mutations: []*api.Mutation{{Set: p.Quads}},
+	}
+	if len(p.Vars) == 0 {
+		return req
+	}
+	b := &strings.Builder{}
+	b.WriteString("{\n")
+	for _, v := range p.Vars {
+		b.WriteString("\t" + v.Name + " as var(func: eq(" + v.Predicate + ", " + v.Value + "))\n")
+	}
+	b.WriteString("}")
+	req.Query = b.String()
+	return req
+}
+
+// keyObject is called by Object at the end of each object with a generated
+// subject when there are Keys. If the object has a key its subject becomes a
+// query variable (the same one for every object with the same key), every
+// quad of the object so far is renamed.
+func (p *Parser) keyObject(l *ParserLevel) {
+	quads := p.Quads[l.Start:]
+	var v *UpsertVar
+	for _, key := range p.Keys {
+		for _, quad := range quads {
+			if quad.Subject != l.Subject || quad.Predicate != key || quad.Lang != "" {
+				continue
+			}
+			if value, ok := queryValue(quad.ObjectValue); ok {
+				v = p.upsertVar(key, value)
+				break
+			}
+		}
+		if v != nil {
+			break
+		}
+	}
+	if v == nil {
+		return
+	}
+	subject := "uid(" + v.Name + ")"
+	p.rename(l, subject)
+}
+
+// upsertVar returns the variable for the key, adding it to p.Vars if it's new.
+func (p *Parser) upsertVar(pred, value string) *UpsertVar {
+	k := [2]string{pred, value}
+	if v, ok := p.vars[k]; ok {
+		return v
+	}
+	if p.vars == nil {
+		p.vars = make(map[[2]string]*UpsertVar)
+	}
+	v := &UpsertVar{
+		Name:      "v" + strconv.Itoa(len(p.Vars)+1),
+		Predicate: pred,
+		Value:     value,
+	}
+	p.vars[k] = v
+	p.Vars = append(p.Vars, v)
+	return v
+}
+
+// queryValue writes v for an eq() function, ok is false for values that
+// can't be keys.
+func queryValue(v *api.Value) (string, bool) {
+	e := &Encoder{}
+	switch val := v.GetVal().(type) {
+	case *api.Value_StrVal:
+		e.quote(val.StrVal)
+	case *api.Value_DefaultVal:
+		if val.DefaultVal == Star {
+			return "", false
+		}
+		e.quote(val.DefaultVal)
+	case *api.Value_IntVal:
+		return strconv.FormatInt(val.IntVal, 10), true
+	case *api.Value_DoubleVal:
+		return strconv.FormatFloat(val.DoubleVal, 'g', -1, 64), true
+	case *api.Value_BoolVal:
+		return strconv.FormatBool(val.BoolVal), true
+	case *api.Value_DatetimeVal:
+		var t time.Time
+		if err := t.UnmarshalBinary(val.DatetimeVal); err != nil {
+			return "", false
+		}
+		e.quote(t.Format(time.RFC3339Nano))
+	default:
+		return "", false
+	}
+	return string(e.buf), true
+}
@@ -0,0 +1,133 @@
+package chunker
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+func TestUpsert(t *testing.T) {
+	req, err := Upsert([]byte(`{
+		"email": "alice@example.com",
+		"name": "Alice",
+		"friend": [
+			{"email": "bob@example.com", "name": "Bob"},
+			{"id": 7, "email": "charlie@example.com"},
+			{"name": "Dave"},
+			{"uid": "0x1", "email": "erin@example.com"}
+		],
+		"boss": {"email": "bob@example.com"}
+	}`), "id", "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+	v1 as var(func: eq(email, "bob@example.com"))
+	v2 as var(func: eq(id, 7))
+	v3 as var(func: eq(email, "alice@example.com"))
+}`
+	if req.Query != expected {
+		t.Fatalf("expected query:\n%s\nbut got:\n%s", expected, req.Query)
+	}
+	if len(req.Mutations) != 1 {
+		t.Fatalf("expected 1 mutation but got %d", len(req.Mutations))
+	}
+	checkQuads(t, req.Mutations[0].Set, []*api.NQuad{{
+		Subject:     "uid(v3)",
+		Predicate:   "email",
+		ObjectValue: val("alice@example.com"),
+	}, {
+		Subject:     "uid(v3)",
+		Predicate:   "name",
+		ObjectValue: val("Alice"),
+	}, {
+		Subject:     "uid(v1)",
+		Predicate:   "email",
+		ObjectValue: val("bob@example.com"),
+	}, {
+		Subject:     "uid(v1)",
+		Predicate:   "name",
+		ObjectValue: val("Bob"),
+	}, {
+		Subject:   "uid(v3)",
+		Predicate: "friend",
+		ObjectId:  "uid(v1)",
+	}, {
+		Subject:     "uid(v2)",
+		Predicate:   "id",
+		ObjectValue: val(int64(7)),
+	}, {
+		Subject:     "uid(v2)",
+		Predicate:   "email",
+		ObjectValue: val("charlie@example.com"),
+	}, {
+		Subject:   "uid(v3)",
+		Predicate: "friend",
+		ObjectId:  "uid(v2)",
+	}, {
+		Subject:     "_:c.4",
+		Predicate:   "name",
+		ObjectValue: val("Dave"),
+	}, {
+		Subject:   "uid(v3)",
+		Predicate: "friend",
+		ObjectId:  "_:c.4",
+	}, {
+		Subject:     "0x1",
+		Predicate:   "email",
+		ObjectValue: val("erin@example.com"),
+	}, {
+		Subject:   "uid(v3)",
+		Predicate: "friend",
+		ObjectId:  "0x1",
+	}, {
+		Subject:     "uid(v1)",
+		Predicate:   "email",
+		ObjectValue: val("bob@example.com"),
+	}, {
+		Subject:   "uid(v3)",
+		Predicate: "boss",
+		ObjectId:  "uid(v1)",
+	}})
+	buf := &bytes.Buffer{}
+	if err = NewEncoder(buf).Encode(req.Mutations[0].Set[4]); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "uid(v3) <friend> uid(v1) .\n" {
+		t.Fatalf("unexpected rdf: %s", buf.String())
+	}
+}
+
+func TestUpsertNoKeys(t *testing.T) {
+	req, err := Upsert([]byte(`{"name": "Alice"}`), "email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Query != "" || len(req.Mutations[0].Set) != 1 {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+}
+
+func TestUpsertLenient(t *testing.T) {
+	p := NewParser()
+	p.Keys = []string{"email"}
+	p.Lenient = true
+	// the first record's friend gets a var before the record is dropped
+	err := p.Run([]byte(`[
+		{"friend": {"email": "bob@example.com"}, "name": {"a|b|c": 1}},
+		{"email": "alice@example.com"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Errors) != 1 {
+		t.Fatalf("expected 1 error but got %d", len(p.Errors))
+	}
+	expected := `{
+	v1 as var(func: eq(email, "alice@example.com"))
+}`
+	if req := p.UpsertRequest(); req.Query != expected {
+		t.Fatalf("expected query:\n%s\nbut got:\n%s", expected, req.Query)
+	}
+}
@@ -0,0 +1,204 @@
+package chunker
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+// XidMap remembers the subject of every external id (xid) the Parser has seen,
+// so the same entity gets the same subject across documents, chunks and
+// loads. Xids are namespaced by type, like "Customer.C-123" (objects without a
+// type just have the xid).
+//
+// The Parser only ever adds blank nodes. Once Dgraph has assigned uids to them
+// they can be Set to the uids, so later loads point at the existing nodes.
+//
+// An XidMap has to be safe for concurrent use, so Parsers working on
+// different chunks (like a Pipeline's, see Pipeline.NewParser) can share one.
+type XidMap interface {
+	// Get returns the subject of xid, ok is false if it doesn't have one yet
+	Get(xid string) (subject string, ok bool, err error)
+	Set(xid, subject string) error
+}
+
+// xidObject is called by Object at the end of each object with a generated
+// subject when there are Xids. If the object has an xid it's given the xid's
+// subject instead, every quad of the object so far is renamed.
+func (p *Parser) xidObject(l *ParserLevel) error {
+	var typ, xid string
+	quads := p.Quads[l.Start:]
+	for _, quad := range quads {
+		if quad.Subject == l.Subject && quad.Predicate == TypePredicate {
+			typ = quad.ObjectValue.GetStrVal()
+			break
+		}
+	}
+	pred, ok := p.Xids[typ]
+	if !ok {
+		// "" is for any object that doesn't have a type of its own in Xids
+		if pred, ok = p.Xids[""]; !ok {
+			return nil
+		}
+	}
+	for _, quad := range quads {
+		if quad.Subject == l.Subject && quad.Predicate == pred && quad.Lang == "" {
+			xid = xidValue(quad.ObjectValue)
+			break
+		}
+	}
+	if xid == "" {
+		return nil
+	}
+	if p.XidMap == nil {
+		p.XidMap = NewMemoryXidMap()
+	}
+	key := xid
+	if typ != "" {
+		key = typ + "." + xid
+	}
+	subject, ok, err := p.XidMap.Get(key)
+	if err != nil {
+		return newParseError(ErrXid, pred, err)
+	}
+	if !ok {
+		subject = xidBlank(key)
+		if err = p.XidMap.Set(key, subject); err != nil {
+			return newParseError(ErrXid, pred, err)
+		}
+	}
+	p.rename(l, subject)
+	return nil
+}
+
+// xidValue returns the xid in v, only strings and ints are xids.
+func xidValue(v *api.Value) string {
+	switch v := v.GetVal().(type) {
+	case *api.Value_StrVal:
+		return v.StrVal
+	case *api.Value_IntVal:
+		return strconv.FormatInt(v.IntVal, 10)
+	}
+	return ""
+}
+
+// xidBlank turns an xid into a blank node, anything that isn't allowed in a
+// blank node name is escaped as _xx (in hex).
+func xidBlank(key string) string {
+	b := &strings.Builder{}
+	b.WriteString("_:xid.")
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// MemoryXidMap is an XidMap that's gone once the process exits.
+type MemoryXidMap struct {
+	mu       sync.RWMutex
+	subjects map[string]string
+}
+
+func NewMemoryXidMap() *MemoryXidMap {
+	return &MemoryXidMap{subjects: make(map[string]string)}
+}
+
+func (m *MemoryXidMap) Get(xid string) (string, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	subject, ok := m.subjects[xid]
+	return subject, ok, nil
+}
+
+func (m *MemoryXidMap) Set(xid, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subjects[xid] = subject
+	return nil
+}
+
+// FileXidMap is an XidMap kept in a file. The whole map is held in memory,
+// every Set is appended to the file as a JSON line like ["xid","subject"] and
+// the last line for an xid wins.
+type FileXidMap struct {
+	*MemoryXidMap
+	file *os.File
+	// mu keeps lines from being written at the same time
+	mu sync.Mutex
+}
+
+// OpenFileXidMap opens (or creates) the FileXidMap at path.
+func OpenFileXidMap(path string) (*FileXidMap, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	m := &FileXidMap{MemoryXidMap: NewMemoryXidMap(), file: file}
+	if err = m.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// load reads every line of the file. A last line without a newline is from a
+// Set that didn't finish, so it's ignored (and overwritten).
+func (m *FileXidMap) load() error {
+	r := bufio.NewReader(m.file)
+	offset := int64(0)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var entry [2]string
+		if err = json.Unmarshal(line, &entry); err != nil {
+			return errors.New(fmt.Sprintf("bad xid map line at offset %d: %v", offset, err))
+		}
+		m.subjects[entry[0]] = entry[1]
+		offset += int64(len(line))
+	}
+	if err := m.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := m.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (m *FileXidMap) Set(xid, subject string) error {
+	line, err := json.Marshal([2]string{xid, subject})
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err = m.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return m.MemoryXidMap.Set(xid, subject)
+}
+
+// Sync flushes the file to disk.
+func (m *FileXidMap) Sync() error {
+	return m.file.Sync()
+}
+
+func (m *FileXidMap) Close() error {
+	return m.file.Close()
+}
@@ -0,0 +1,165 @@
+package chunker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v2/protos/api"
+)
+
+func TestXids(t *testing.T) {
+	xids := NewMemoryXidMap()
+	run := func(d string) []*api.NQuad {
+		t.Helper()
+		p := NewParser()
+		p.Types = TypePredicates{"customer": "Customer"}
+		p.Xids = map[string]string{"Customer": "customer_id", "": "id"}
+		p.XidMap = xids
+		if err := p.Run([]byte(d)); err != nil {
+			t.Fatal(err)
+		}
+		return p.Quads
+	}
+	checkQuads(t, run(`{
+		"id": 7,
+		"customer": {"customer_id": "C 1", "name": "Alice"}
+	}`), []*api.NQuad{{
+		Subject:     "_:xid.7",
+		Predicate:   "id",
+		ObjectValue: val(int64(7)),
+	}, {
+		Subject:     "_:xid.Customer.C_201",
+		Predicate:   "customer_id",
+		ObjectValue: val("C 1"),
+	}, {
+		Subject:     "_:xid.Customer.C_201",
+		Predicate:   "name",
+		ObjectValue: val("Alice"),
+	}, {
+		Subject:     "_:xid.Customer.C_201",
+		Predicate:   TypePredicate,
+		ObjectValue: val("Customer"),
+	}, {
+		Subject:   "_:xid.7",
+		Predicate: "customer",
+		ObjectId:  "_:xid.Customer.C_201",
+	}})
+	// once Dgraph has given the customer a uid, it's used from then on
+	if err := xids.Set("Customer.C 1", "0x10"); err != nil {
+		t.Fatal(err)
+	}
+	checkQuads(t, run(`{
+		"uid": "0x1",
+		"customer": [{"customer_id": "C 1"}, {"customer_id": "C 2"}, {"name": "Bob"}]
+	}`), []*api.NQuad{{
+		Subject:     "0x10",
+		Predicate:   "customer_id",
+		ObjectValue: val("C 1"),
+	}, {
+		Subject:     "0x10",
+		Predicate:   TypePredicate,
+		ObjectValue: val("Customer"),
+	}, {
+		Subject:   "0x1",
+		Predicate: "customer",
+		ObjectId:  "0x10",
+	}, {
+		Subject:     "_:xid.Customer.C_202",
+		Predicate:   "customer_id",
+		ObjectValue: val("C 2"),
+	}, {
+		Subject:     "_:xid.Customer.C_202",
+		Predicate:   TypePredicate,
+		ObjectValue: val("Customer"),
+	}, {
+		Subject:   "0x1",
+		Predicate: "customer",
+		ObjectId:  "_:xid.Customer.C_202",
+	}, {
+		Subject:     "_:c.4",
+		Predicate:   "name",
+		ObjectValue: val("Bob"),
+	}, {
+		Subject:     "_:c.4",
+		Predicate:   TypePredicate,
+		ObjectValue: val("Customer"),
+	}, {
+		Subject:   "0x1",
+		Predicate: "customer",
+		ObjectId:  "_:c.4",
+	}})
+}
+
+func TestFileXidMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "xids")
+	m, err := OpenFileXidMap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, set := range [][2]string{{"a", "_:xid.a"}, {"b\n", "_:xid.b_0a"}, {"a", "0x1"}} {
+		if err = m.Set(set[0], set[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// a Set that was cut off halfway
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString(`["c","_:`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if m, err = OpenFileXidMap(path); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	for xid, expected := range map[string]string{"a": "0x1", "b\n": "_:xid.b_0a", "c": ""} {
+		if subject, _, _ := m.Get(xid); subject != expected {
+			t.Fatalf("expected %q for %q but got %q", expected, xid, subject)
+		}
+	}
+	if err = m.Set("c", "0x3"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), "[\"a\",\"0x1\"]\n[\"c\",\"0x3\"]\n") {
+		t.Fatalf("unexpected file:\n%s", b)
+	}
+}
+
+func TestXidsReverse(t *testing.T) {
+	p := NewParser()
+	p.Xids = map[string]string{"": "id"}
+	if err := p.Run([]byte(`{"id": "a", "~friend": {"id": "b"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	// the reverse edge points at the parent before it's renamed
+	checkQuads(t, p.Quads, []*api.NQuad{{
+		Subject:     "_:xid.a",
+		Predicate:   "id",
+		ObjectValue: val("a"),
+	}, {
+		Subject:     "_:xid.b",
+		Predicate:   "id",
+		ObjectValue: val("b"),
+	}, {
+		Subject:   "_:xid.b",
+		Predicate: "friend",
+		ObjectId:  "_:xid.a",
+	}})
+}